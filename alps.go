@@ -0,0 +1,61 @@
+package browser_impersonate
+
+import "encoding/binary"
+
+// ALPS (application_settings) extension codepoints, neither is IANA assigned.
+// Chrome moved to the new one in 131.
+const (
+	ALPSCodepoint    uint16 = 17513
+	ALPSCodepointNew uint16 = 17613
+)
+
+// HTTP2Setting is one parameter of a SETTINGS frame.
+type HTTP2Setting struct {
+	ID    uint16
+	Value uint32
+}
+
+// ChromiumHTTP2Settings are the SETTINGS Chromium opens its HTTP2 connections with, in wire order.
+var ChromiumHTTP2Settings = []HTTP2Setting{
+	{ID: 1, Value: 65536},   // HEADER_TABLE_SIZE
+	{ID: 2, Value: 0},       // ENABLE_PUSH
+	{ID: 4, Value: 6291456}, // INITIAL_WINDOW_SIZE
+	{ID: 6, Value: 262144},  // MAX_HEADER_LIST_SIZE
+}
+
+// GetALPSCodepoint returns the application_settings extension the browser offers in its ClientHello, 0 when it sends none.
+// Only Chromium negotiates ALPS, Chrome on iOS uses the WebKit stack.
+// ALPS is only offered on azuretls: tls-client builds its tls.Config itself and could not send the SETTINGS payload,
+// so its Chromium profile keeps offering none rather than an empty client application_settings.
+func GetALPSCodepoint(impersonateOption ImpersonateOption) uint16 {
+	if !impersonateOption.Browser.Type.IsChromium() || impersonateOption.UsesWebKit() {
+		return 0
+	}
+	version := impersonateOption.Browser.Version
+	if version == 0 {
+		version = GetLatestVersion(impersonateOption.Browser.Type)
+	}
+	if version < 131 {
+		return ALPSCodepoint
+	}
+	return ALPSCodepointNew
+}
+
+// GetALPSSettings returns the ALPS payload the browser sends for h2 once the server accepted ALPS,
+// the SETTINGS frame payload it also sends after the connection preface. nil when the browser sends no ALPS.
+func GetALPSSettings(impersonateOption ImpersonateOption) []byte {
+	if GetALPSCodepoint(impersonateOption) == 0 {
+		return nil
+	}
+	return EncodeHTTP2Settings(ChromiumHTTP2Settings)
+}
+
+// EncodeHTTP2Settings encodes settings as in the payload of a SETTINGS frame, 6 bytes per setting.
+func EncodeHTTP2Settings(settings []HTTP2Setting) []byte {
+	payload := make([]byte, 0, 6*len(settings))
+	for _, setting := range settings {
+		payload = binary.BigEndian.AppendUint16(payload, setting.ID)
+		payload = binary.BigEndian.AppendUint32(payload, setting.Value)
+	}
+	return payload
+}
@@ -0,0 +1,52 @@
+package browser_impersonate
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetALPSCodepoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   uint16
+	}{
+		{name: "latest chrome", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}, want: ALPSCodepointNew},
+		{name: "chrome 131", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 131}}, want: ALPSCodepointNew},
+		{name: "chrome 130", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 130}}, want: ALPSCodepoint},
+		{name: "edge 120", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserEdge, Version: 120}}, want: ALPSCodepoint},
+		{name: "chrome on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserChrome}}},
+		{name: "firefox", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}},
+		{name: "safari", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}}},
+	}
+	for _, test := range tests {
+		if got := GetALPSCodepoint(test.option); got != test.want {
+			t.Errorf("%s: GetALPSCodepoint() = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetALPSSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   []byte
+	}{
+		{
+			name:   "chrome",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want: []byte{
+				0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
+				0x00, 0x02, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x04, 0x00, 0x60, 0x00, 0x00,
+				0x00, 0x06, 0x00, 0x04, 0x00, 0x00,
+			},
+		},
+		{name: "firefox", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}},
+	}
+	for _, test := range tests {
+		if got := GetALPSSettings(test.option); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: GetALPSSettings() = %x, want %x", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package browser_impersonate
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ImpersonateApp identifies the mobile app a native HTTP client persona belongs to.
+type ImpersonateApp struct {
+	Name    string // Bundle executable name, as CFNetwork puts it in the User-Agent
+	Version string // Build number of the app, "1" by default
+}
+
+// IsNativeApp reports whether the persona is the HTTP stack of a mobile app instead of a browser.
+func (b BrowserType) IsNativeApp() bool {
+	return b == BrowserOkHttp || b == BrowserCFNetwork
+}
+
+var okHttpVersions = map[int]string{
+	3: "3.14.9",
+	4: "4.12.0",
+	5: "5.1.0",
+}
+
+// CFNetwork version shipped with each iOS major version, Darwin follows the iOS version.
+var cfNetworkVersions = map[int]string{
+	15: "1335.0.3",
+	16: "1410.0.3",
+	17: "1498.700.2",
+	18: "3826.600.41",
+	26: "3860.100.1",
+}
+
+// GetOkHttpUserAgent returns the default User-Agent of OkHttp, apps often overwrite it.
+func GetOkHttpUserAgent(impersonateOption ImpersonateOption) string {
+	version := impersonateOption.Browser.Version
+	if version == 0 {
+		version = GetLatestVersion(BrowserOkHttp)
+	}
+	return "okhttp/" + okHttpVersions[version]
+}
+
+// GetCFNetworkUserAgent returns the User-Agent NSURLSession sends when the app does not set one.
+func GetCFNetworkUserAgent(impersonateOption ImpersonateOption) string {
+	numbers := parseOSVersion(impersonateOption.GetOSVersion())
+	major, minor := 26, 0
+	if len(numbers) > 0 {
+		major = numbers[0]
+	}
+	if len(numbers) > 1 {
+		minor = numbers[1]
+	}
+	darwin := major + 6
+	if major >= 26 {
+		darwin = major - 1
+	}
+	appVersion := impersonateOption.App.Version
+	if appVersion == "" {
+		appVersion = "1"
+	}
+	return fmt.Sprintf("%s/%s CFNetwork/%s Darwin/%d.%d.0", url.PathEscape(impersonateOption.App.Name), appVersion, cfNetworkVersions[major], darwin, minor)
+}
+
+// Default headers of the native HTTP clients, they do not send any of the browser navigation headers.
+func impersonateAppHeaders(hSet func(key string, value string), impersonateOption ImpersonateOption) {
+	switch impersonateOption.Browser.Type {
+	case BrowserOkHttp:
+		// BridgeInterceptor only adds transparent gzip
+		hSet("Accept-Encoding", "gzip")
+		hSet("User-Agent", GetOkHttpUserAgent(impersonateOption))
+	case BrowserCFNetwork:
+		hSet("Accept", "*/*")
+		hSet("Accept-Language", GetAcceptLanguage(BrowserSafari, impersonateOption.GetLocales()))
+		hSet("Accept-Encoding", "gzip, deflate, br")
+		hSet("User-Agent", GetCFNetworkUserAgent(impersonateOption))
+	}
+}
@@ -0,0 +1,70 @@
+package browser_impersonate
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestImpersonateHeadersNativeApp(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name:   "latest okhttp",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}},
+			want: map[string]string{
+				"User-Agent":                "okhttp/5.1.0",
+				"Accept-Encoding":           "gzip",
+				"Accept":                    "",
+				"Accept-Language":           "",
+				"Upgrade-Insecure-Requests": "",
+			},
+		},
+		{
+			name:   "okhttp 4",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp, Version: 4}},
+			want: map[string]string{
+				"User-Agent": "okhttp/4.12.0",
+			},
+		},
+		{
+			name:   "cfnetwork on ios 18",
+			option: ImpersonateOption{OS: IOS, OSVersion: "18.6", Browser: ImpersonateBrowser{Type: BrowserCFNetwork}, App: ImpersonateApp{Name: "My App", Version: "42"}, Country: "FR"},
+			want: map[string]string{
+				"User-Agent":                "My%20App/42 CFNetwork/3826.600.41 Darwin/24.6.0",
+				"Accept":                    "*/*",
+				"Accept-Language":           "fr-FR,fr;q=0.9",
+				"Accept-Encoding":           "gzip, deflate, br",
+				"Upgrade-Insecure-Requests": "",
+				"Sec-Fetch-Mode":            "",
+			},
+		},
+		{
+			name:   "cfnetwork on the default ios",
+			option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserCFNetwork}, App: ImpersonateApp{Name: "Weather"}},
+			want: map[string]string{
+				"User-Agent": "Weather/1 CFNetwork/3860.100.1 Darwin/25.1.0",
+			},
+		},
+		{
+			name:   "cfnetwork on ios 17",
+			option: ImpersonateOption{OS: IOS, OSVersion: "17.5", Browser: ImpersonateBrowser{Type: BrowserCFNetwork}, App: ImpersonateApp{Name: "Weather"}},
+			want: map[string]string{
+				"User-Agent": "Weather/1 CFNetwork/1498.700.2 Darwin/23.5.0",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -3,48 +3,686 @@
 package browser_impersonate
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weak"
+
 	"github.com/Noooste/azuretls-client"
 
 	fhttp "github.com/Noooste/fhttp"
+	"github.com/Noooste/fhttp/http2"
+	"github.com/Noooste/fhttp/httptrace"
+	tls "github.com/Noooste/utls"
+)
+
+const (
+	OkHttpJa3                 = "771,4865-4866-4867-49195-49196-52393-49199-49200-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-51-45-43-21,29-23-24,0"
+	OkHttpHTTP2Fingerprint    = "4:16777216|16711681|0|m,p,a,s"
+	CFNetworkHTTP2Fingerprint = "2:0,4:2097152,3:100,9:1|10485760|0|m,s,p,a"
+	// Firefox before 120, with its PRIORITY frame tree, see GetHTTP2PriorityFrames
+	FirefoxLegacyHTTP2Fingerprint = "1:65536,4:131072,5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s"
 )
 
 func NewImpersonateAzureTLSsession(impersonateOption ImpersonateOption) (*azuretls.Session, error) {
+	if err := impersonateOption.Validate(); err != nil {
+		return nil, err
+	}
 	newSession := azuretls.NewSession()
-	SetImpersonateAzureTLS(newSession, impersonateOption)
+	if err := SetImpersonateAzureTLS(newSession, impersonateOption); err != nil {
+		return nil, err
+	}
 	return newSession, nil
 }
 
 // Utility function to set the specific emulation option on a given AzureTLS Sessionxc
 func SetImpersonateAzureTLS(session *azuretls.Session, impersonateOption ImpersonateOption) error {
+	if err := impersonateOption.Validate(); err != nil {
+		return err
+	}
 	// Headers
 	if !impersonateOption.SkipHeaders {
 		defaultHeaders := make(fhttp.Header)
 		ImpersonateHeaders(defaultHeaders, impersonateOption, true)
 		session.Header = defaultHeaders
+		proxyHeaders := fhttp.Header(GetProxyConnectHeaders(impersonateOption))
+		proxyHeaders[fhttp.HeaderOrderKey] = GetProxyConnectHeaderOrderKey(impersonateOption)
+		session.ProxyHeader = proxyHeaders
 	}
 	if !impersonateOption.SkipHeaderOrder {
 		session.HeaderOrder = GetHeaderOrder(impersonateOption)
 	}
+	if impersonateOption.TLSSessionStore == nil {
+		impersonateOption.TLSSessionStore = NewTLSSessionStore()
+	}
+	// The hooks reach the session weakly, the session holding them would never be finalized otherwise
+	sessionKey := weak.Make(session)
+	if _, hooked := azureImpersonatedSessions.Swap(sessionKey, impersonateOption); !hooked {
+		proxy := &azureTLSProxy{}
+		azureTLSProxies.Store(sessionKey, proxy)
+		runtime.AddCleanup(session, func(sessionKey weak.Pointer[azuretls.Session]) {
+			azureImpersonatedSessions.Delete(sessionKey)
+			azureTLSProxies.Delete(sessionKey)
+		}, sessionKey)
+		protocols := &negotiatedProtocols{}
+		echConfigs := &echConfigCache{}
+		previousHook := session.PreHookWithContext
+		session.PreHookWithContext = func(ctx *azuretls.Context) error {
+			if previousHook != nil {
+				if err := previousHook(ctx); err != nil {
+					return err
+				}
+			}
+			return impersonateAzureTLSRequest(ctx, protocols, echConfigs, proxy)
+		}
+		previousDial := session.Dial
+		// A Dial set on the session before dials on its own, the proxy ones included
+		session.Dial = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			if previousDial != nil {
+				return previousDial(ctx, network, addr)
+			}
+			session := sessionKey.Value()
+			if session == nil {
+				return nil, net.ErrClosed
+			}
+			return proxy.dial(ctx, session, network, addr)
+		}
+		previousModifyDialer := session.ModifyDialer
+		session.ModifyDialer = func(dialer *net.Dialer) error {
+			if previousModifyDialer != nil {
+				if err := previousModifyDialer(dialer); err != nil {
+					return err
+				}
+			}
+			// Only direct connections are dialed here, proxies resolve the hosts they connect to
+			if impersonateOption, ok := getAzureImpersonateOption(sessionKey); ok {
+				if impersonateDialer, ok := GetDialer(impersonateOption); ok {
+					if impersonateDialer.Resolver != nil {
+						dialer.Resolver = impersonateDialer.Resolver
+						dialer.FallbackDelay = impersonateDialer.FallbackDelay
+					}
+					if impersonateDialer.Control != nil {
+						dialer.Control = impersonateDialer.Control
+					}
+				}
+			}
+			return nil
+		}
+		previousModifyConfig := session.ModifyConfig
+		session.ModifyConfig = func(config *tls.Config) error {
+			if previousModifyConfig != nil {
+				if err := previousModifyConfig(config); err != nil {
+					return err
+				}
+			}
+			impersonateOption, ok := getAzureImpersonateOption(sessionKey)
+			if !ok {
+				return nil
+			}
+			// Sent in the client application_settings once the server accepted ALPS
+			if settings := GetALPSSettings(impersonateOption); settings != nil {
+				config.ApplicationSettings = map[string][]byte{"h2": settings}
+			}
+			// The GREASE ECH extension of the preset becomes the real one, the preset shapes both ClientHellos
+			config.EncryptedClientHelloConfigList = echConfigs.get(config.ServerName)
+			if configList, serverName := config.EncryptedClientHelloConfigList, config.ServerName; configList != nil {
+				// A rejected ECH fails the request as it does in browsers, the connection retrying it sends GREASE ECH.
+				// Nothing goes over the rejected connection, its certificate is not checked against the inner server name as utls would.
+				config.EncryptedClientHelloRejectionVerify = func(tls.ConnectionState) error {
+					echConfigs.reject(serverName, configList)
+					return nil
+				}
+			}
+			if ResumesTLSSessions(impersonateOption) {
+				config.ClientSessionCache = azureTLSSessionCache{store: impersonateOption.TLSSessionStore}
+			}
+			// pre_shared_key is only sent once there is a ticket to resume with,
+			// presets without the extension do not resume TLS 1.3 sessions instead of failing the handshake
+			config.OmitEmptyPsk = true
+			config.PreferSkipResumptionOnNilExtension = true
+			return nil
+		}
+		previousCallback := session.CallbackWithContext
+		session.CallbackWithContext = func(ctx *azuretls.Context) {
+			if previousCallback != nil {
+				previousCallback(ctx)
+			}
+			if ctx.Err == nil && ctx.Response != nil && ctx.Response.HttpResponse != nil && ctx.Response.HttpResponse.Request != nil {
+				protocols.learn(ctx.Response.HttpResponse.Request.URL, ctx.Response.HttpResponse.ProtoMajor)
+			}
+			impersonateOption, ok := getAzureImpersonateOption(sessionKey)
+			if !ok || impersonateOption.ProxyPool == nil || ctx.Request == nil || ctx.Request.Context() == nil {
+				return
+			}
+			sent, ok := ctx.Request.Context().Value(azureTLSRequestProxyKey{}).(azureTLSRequestProxy)
+			if !ok {
+				return
+			}
+			proxy.closeStale(ctx.Session, sent)
+			if sent.ctx.Err() != nil {
+				// Requests the caller gave up on say nothing about the proxy
+				return
+			}
+			statusCode := 0
+			if ctx.Response != nil {
+				statusCode = ctx.Response.StatusCode
+			}
+			if proxyURL, rotated := impersonateOption.ProxyPool.Report(impersonateOption.ProxyKey, sent.proxyURL, statusCode, ctx.Err); rotated {
+				if err := proxy.swap(ctx.Session, sent.proxyURL, proxyURL); err != nil && ctx.Err == nil {
+					ctx.Err = err
+				}
+			}
+		}
+	}
+	if impersonateOption.ProxyPool != nil {
+		proxyURL, err := impersonateOption.ProxyPool.Acquire(impersonateOption.ProxyKey)
+		if err != nil {
+			return err
+		}
+		if err := getAzureTLSProxy(sessionKey).set(session, proxyURL); err != nil {
+			return err
+		}
+	}
 
 	// TlS Fingerprinting:
-	switch impersonateOption.Browser.Type {
-	case BrowserSafari:
+	session.GetClientHelloSpec = nil
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		// No OkHttp preset in azuretls, Android's Conscrypt ClientHello and OkHttp's HTTP2 settings
+		if err := session.ApplyJa3(OkHttpJa3, azuretls.Chrome); err != nil {
+			return err
+		}
+		if err := session.ApplyHTTP2(OkHttpHTTP2Fingerprint); err != nil {
+			return err
+		}
+	case impersonateOption.Browser.Type == BrowserCFNetwork:
+		session.Browser = azuretls.Ios
+		if err := session.ApplyHTTP2(CFNetworkHTTP2Fingerprint); err != nil {
+			return err
+		}
+	case impersonateOption.Browser.Type == BrowserChrome && impersonateOption.OS == IOS:
+		session.Browser = azuretls.Ios
+	case impersonateOption.UsesWebKit():
 		switch impersonateOption.OS {
 		case MacOS:
 			session.Browser = azuretls.Safari
-			// newOptions = append(newOptions, tls_client.WithClientProfile())
 		case IOS:
+			// Every other iOS browser uses the WebKit stack, as do iPads even when presenting a macOS User-Agent.
 			session.Browser = azuretls.Ios
 		}
-	case BrowserChrome, BrowserBrave, BrowserEdge:
-		if impersonateOption.Browser.Type == BrowserChrome && impersonateOption.OS == IOS {
-
-			session.Browser = azuretls.Ios
-		} else {
-			session.Browser = azuretls.Chrome
+	case impersonateOption.Browser.Type.IsChromium():
+		session.Browser = azuretls.Chrome
+		// One extension order per session, as Chrome shuffles once per launch
+		seed := GetTLSExtensionSeed(impersonateOption)
+		alpsCodepoint := GetALPSCodepoint(impersonateOption)
+		session.GetClientHelloSpec = func() *tls.ClientHelloSpec {
+			spec := azuretls.GetLastChromeVersion()
+			spec.Extensions = setAzureALPSCodepoint(spec.Extensions, alpsCodepoint)
+			spec.Extensions = permuteExtensions(spec.Extensions, seed, getAzureTLSExtensionID)
+			// BoringSSL puts pre_shared_key last, after the padding
+			spec.Extensions = append(spec.Extensions, &tls.UtlsPreSharedKeyExtension{})
+			return spec
 		}
-	case BrowserFirefox:
+	case impersonateOption.Browser.Type.IsGecko():
 		session.Browser = azuretls.Firefox
+		if ResumesTLSSessions(impersonateOption) {
+			session.GetClientHelloSpec = func() *tls.ClientHelloSpec {
+				spec := azuretls.GetLastFirefoxVersion()
+				// NSS puts pre_shared_key last as well
+				spec.Extensions = append(spec.Extensions, &tls.UtlsPreSharedKeyExtension{})
+				return spec
+			}
+		}
+		if len(GetHTTP2PriorityFrames(impersonateOption)) > 0 {
+			if err := session.ApplyHTTP2(FirefoxLegacyHTTP2Fingerprint); err != nil {
+				return err
+			}
+		}
+	}
+	specFunc := session.GetClientHelloSpec
+	if specFunc == nil {
+		specFunc = azuretls.GetBrowserClientHelloFunc(session.Browser)
+	}
+	postQuantumGroup := GetPostQuantumGroup(impersonateOption)
+	session.GetClientHelloSpec = func() *tls.ClientHelloSpec {
+		spec := specFunc()
+		spec.Extensions = setAzurePostQuantumGroup(spec.Extensions, postQuantumGroup)
+		return spec
+	}
+	// The fhttp HTTP2 transport puts one priority on the HEADERS frames of every request, the one of navigations.
+	// Subresources are only told apart by their Priority header.
+	priority := GetHTTP2Priority(impersonateOption, DestinationDocument)
+	session.HeaderPriority = &http2.PriorityParam{StreamDep: priority.StreamDep, Exclusive: priority.Exclusive, Weight: priority.Weight}
+	if session.HTTP2Transport != nil {
+		session.HTTP2Transport.HeaderPriority = session.HeaderPriority
+	}
+	return nil
+}
+
+// Impersonation option of each session, so setting it again does not stack PreHooks.
+// Sessions are weakly referenced, their option is forgotten once they are garbage collected.
+var azureImpersonatedSessions sync.Map
+
+func getAzureImpersonateOption(sessionKey weak.Pointer[azuretls.Session]) (ImpersonateOption, bool) {
+	value, ok := azureImpersonatedSessions.Load(sessionKey)
+	if !ok {
+		return ImpersonateOption{}, false
+	}
+	return value.(ImpersonateOption), true
+}
+
+// Proxy of each impersonated session, sessions are weakly referenced as in azureImpersonatedSessions.
+var azureTLSProxies sync.Map
+
+func getAzureTLSProxy(sessionKey weak.Pointer[azuretls.Session]) *azureTLSProxy {
+	value, ok := azureTLSProxies.Load(sessionKey)
+	if !ok {
+		return nil
+	}
+	return value.(*azureTLSProxy)
+}
+
+// azureTLSProxy serializes the proxy changes of a session with its dials, azuretls swaps its proxy dialer unlocked.
+// Each change starts a generation, the connections of requests sent in an earlier one are closed once they are idle
+// as azuretls only closes the HTTP/1.1 connections idle at the time of the change.
+type azureTLSProxy struct {
+	mu         sync.RWMutex
+	proxyURL   string
+	generation uint64
+}
+
+// Proxy a request was sent through, reported to the ProxyPool instead of the one the session moved to meanwhile.
+// ctx is the context of the caller, before azuretls adds the timeout of the session to it.
+type azureTLSRequestProxy struct {
+	proxyURL   string
+	generation uint64
+	ctx        context.Context
+}
+
+type azureTLSRequestProxyKey struct{}
+
+func (p *azureTLSProxy) current() azureTLSRequestProxy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return azureTLSRequestProxy{proxyURL: p.proxyURL, generation: p.generation}
+}
+
+// dial is the dial of azuretls, with the proxy dialer read under mu.
+func (p *azureTLSProxy) dial(ctx context.Context, session *azuretls.Session, network string, addr string) (net.Conn, error) {
+	p.mu.RLock()
+	proxyDialer := session.ProxyDialer
+	p.mu.RUnlock()
+	if proxyDialer != nil {
+		userAgent := session.UserAgent
+		// Key of the request User-Agent in the azuretls dial context
+		if requestUserAgent, ok := ctx.Value("user-agent").(string); ok {
+			userAgent = requestUserAgent
+		}
+		return proxyDialer.DialContext(ctx, userAgent, network, addr)
+	}
+	dialer := &net.Dialer{Timeout: session.TimeOut, KeepAlive: 30 * time.Second}
+	if session.ModifyDialer != nil {
+		if err := session.ModifyDialer(dialer); err != nil {
+			return nil, err
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (p *azureTLSProxy) set(session *azuretls.Session, proxyURL string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.setLocked(session, proxyURL)
+}
+
+// swap moves the session from the proxy from to proxyURL, unless a concurrent request did already.
+func (p *azureTLSProxy) swap(session *azuretls.Session, from string, proxyURL string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.proxyURL != from || p.proxyURL == proxyURL {
+		return nil
+	}
+	return p.setLocked(session, proxyURL)
+}
+
+func (p *azureTLSProxy) setLocked(session *azuretls.Session, proxyURL string) error {
+	if err := session.SetProxy(proxyURL); err != nil {
+		return err
 	}
+	p.proxyURL = proxyURL
+	p.generation++
+	closeAzureTLSIdleConnections(session)
 	return nil
 }
+
+// closeStale closes the connections a request sent before the last proxy change gave back to the session.
+func (p *azureTLSProxy) closeStale(session *azuretls.Session, sent azureTLSRequestProxy) {
+	if p.current().generation != sent.generation {
+		closeAzureTLSIdleConnections(session)
+	}
+}
+
+func closeAzureTLSIdleConnections(session *azuretls.Session) {
+	if session.HTTP2Transport != nil {
+		session.HTTP2Transport.CloseIdleConnections()
+	}
+	if session.Transport != nil {
+		session.Transport.CloseIdleConnections()
+	}
+}
+
+// Recomputes the headers of requests carrying RequestHints in their context, and of plain http:// requests.
+// Generated headers are rewritten to their HTTP/1.1 form for origins ALPN did not pick h2 with.
+// Requests with OrderedHeaders are left untouched, the caller took full control of them.
+func impersonateAzureTLSRequest(ctx *azuretls.Context, protocols *negotiatedProtocols, echConfigs *echConfigCache, proxy *azureTLSProxy) error {
+	impersonateOption, ok := getAzureImpersonateOption(weak.Make(ctx.Session))
+	if !ok {
+		return nil
+	}
+	request := ctx.Request
+	target, err := url.Parse(request.Url)
+	if err != nil {
+		return err
+	}
+	requestCtx := request.Context()
+	if requestCtx == nil {
+		// azuretls falls back to the session context after the hooks ran
+		requestCtx = ctx.Session.Context()
+	}
+	if impersonateOption.ProxyPool != nil {
+		sent := proxy.current()
+		sent.ctx = requestCtx
+		requestCtx = context.WithValue(requestCtx, azureTLSRequestProxyKey{}, sent)
+		request.SetContext(requestCtx)
+	}
+	// HTTP/3 advertised in the HTTPS record is used right away, instead of after an Alt-Svc header
+	http3Enabled := ctx.Session.HTTP3Config != nil && ctx.Session.HTTP3Config.Enabled
+	if resolver := GetResolver(impersonateOption); resolver != nil && http3Enabled && target.Scheme == "https" && !request.ForceHTTP1 {
+		if record, ok := GetHTTPSRecord(requestCtx, resolver, target.Hostname()); ok && slices.Contains(record.ALPN, "h3") {
+			request.ForceHTTP3 = true
+		}
+	}
+	if target.Scheme == "https" && !request.ForceHTTP3 {
+		echConfigs.lookup(requestCtx, impersonateOption, target.Hostname())
+	}
+	if impersonateOption.SkipHeaders || request.OrderedHeaders != nil {
+		return nil
+	}
+	setOrder := !impersonateOption.SkipHeaderOrder && (len(request.HeaderOrder) == 0 || slices.Equal(request.HeaderOrder, ctx.Session.HeaderOrder))
+	hints, ok := RequestHintsFromContext(request.Context())
+	if ok || target.Scheme == "http" {
+		headers := make(fhttp.Header)
+		ImpersonateRequestHeaders(headers, impersonateOption, hints, request.Method, target)
+		// Headers set on the request by the caller, the ones differing from the session defaults, win
+		for k, v := range request.Header {
+			if !slices.Equal(ctx.Session.Header[k], v) {
+				headers[k] = v
+			}
+		}
+		request.Header = headers
+		if setOrder {
+			request.HeaderOrder = GetRequestHeaderOrder(impersonateOption, target)
+		}
+	}
+
+	http1, known := protocols.usesHTTP1(target)
+	switch {
+	case request.ForceHTTP1:
+		http1, known = true, true
+	case request.ForceHTTP3:
+		http1, known = false, true
+	}
+	if known {
+		if http1 {
+			headers := request.Header.Clone()
+			ImpersonateHTTP1Headers(headers, impersonateOption)
+			request.Header = headers
+			if setOrder {
+				request.HeaderOrder = GetHTTP1HeaderOrderKey(impersonateOption)
+			}
+		}
+		return nil
+	}
+	// First connection to the origin: both fhttp transports report it before writing the headers of the outgoing request.
+	// Connections not telling their ALPN keep the HTTP/2 form, HTTP/1.1 writes it too.
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if conn, ok := info.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok && conn.ConnectionState().NegotiatedProtocol != "h2" {
+				// Headers were copied to the outgoing request when it was built
+				headers := request.HttpRequest.Header
+				ImpersonateHTTP1Headers(headers, impersonateOption)
+				if setOrder {
+					headers[fhttp.HeaderOrderKey] = GetHTTP1HeaderOrderKey(impersonateOption)
+				}
+			}
+		},
+	}
+	request.SetContext(httptrace.WithClientTrace(requestCtx, trace))
+	return nil
+}
+
+// Resumes azuretls connections from the TLSSessionStore of the persona.
+type azureTLSSessionCache struct {
+	store *TLSSessionStore
+}
+
+func (c azureTLSSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	ticket, ok := c.store.Get(sessionKey)
+	if !ok {
+		return nil, false
+	}
+	state, err := tls.ParseSessionState(ticket.State)
+	if err != nil {
+		c.store.Delete(sessionKey)
+		return nil, false
+	}
+	session, err := tls.NewResumptionState(ticket.Ticket, state)
+	if err != nil {
+		c.store.Delete(sessionKey)
+		return nil, false
+	}
+	return session, true
+}
+
+func (c azureTLSSessionCache) Put(sessionKey string, session *tls.ClientSessionState) {
+	if session == nil {
+		c.store.Delete(sessionKey)
+		return
+	}
+	ticket, state, err := session.ResumptionState()
+	if err != nil || state == nil {
+		return
+	}
+	stateBytes, err := state.Bytes()
+	if err != nil {
+		return
+	}
+	c.store.Put(sessionKey, TLSSessionTicket{Ticket: ticket, State: stateBytes})
+}
+
+// Replaces the application_settings extension with the one of the codepoint, drops it when the codepoint is 0.
+func setAzureALPSCodepoint(extensions []tls.TLSExtension, codepoint uint16) []tls.TLSExtension {
+	return replaceALPSExtension(extensions, codepoint, func(extension tls.TLSExtension) ([]string, bool) {
+		switch alps := extension.(type) {
+		case *tls.ApplicationSettingsExtension:
+			return alps.SupportedProtocols, true
+		case *tls.ApplicationSettingsExtensionNew:
+			return alps.SupportedProtocols, true
+		}
+		return nil, false
+	}, func(codepoint uint16, supportedProtocols []string) tls.TLSExtension {
+		if codepoint == ALPSCodepoint {
+			return &tls.ApplicationSettingsExtension{SupportedProtocols: supportedProtocols}
+		}
+		return &tls.ApplicationSettingsExtensionNew{SupportedProtocols: supportedProtocols}
+	})
+}
+
+// Replaces the post-quantum group in supported_groups and key_share, drops it when the group is 0.
+// The group goes first after GREASE when the preset had none.
+func setAzurePostQuantumGroup(extensions []tls.TLSExtension, group uint16) []tls.TLSExtension {
+	for _, extension := range extensions {
+		switch extension := extension.(type) {
+		case *tls.SupportedCurvesExtension:
+			extension.Curves = replacePostQuantumGroup(extension.Curves, func(curve tls.CurveID) uint16 {
+				return uint16(curve)
+			}, group, func(group uint16) tls.CurveID {
+				return tls.CurveID(group)
+			})
+		case *tls.KeyShareExtension:
+			extension.KeyShares = replacePostQuantumGroup(extension.KeyShares, func(keyShare tls.KeyShare) uint16 {
+				return uint16(keyShare.Group)
+			}, group, func(group uint16) tls.KeyShare {
+				return tls.KeyShare{Group: tls.CurveID(group)}
+			})
+		}
+	}
+	return extensions
+}
+
+// Same extensions as tls.ShuffleChromeTLSExtensions keeps in place
+func getAzureTLSExtensionID(extension tls.TLSExtension) (uint16, bool) {
+	switch extension.(type) {
+	case *tls.UtlsGREASEExtension, *tls.UtlsPaddingExtension, tls.PreSharedKeyExtension:
+		return 0, false
+	case *tls.SNIExtension:
+		// server_name is empty until the handshake
+		return 0, true
+	}
+	raw := make([]byte, extension.Len())
+	if n, _ := extension.Read(raw); n < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(raw), true
+}
+
+// CloseImpersonateAzureTLSsession closes the session, forgets its persona and releases its proxy binding.
+func CloseImpersonateAzureTLSsession(session *azuretls.Session) {
+	sessionKey := weak.Make(session)
+	if impersonateOption, ok := getAzureImpersonateOption(sessionKey); ok && impersonateOption.ProxyPool != nil {
+		impersonateOption.ProxyPool.Release(impersonateOption.ProxyKey)
+	}
+	azureImpersonatedSessions.Delete(sessionKey)
+	azureTLSProxies.Delete(sessionKey)
+	session.Close()
+}
+
+// NewAzureTLSSessionPool returns a pool of azuretls sessions impersonating the personas of generator.
+func NewAzureTLSSessionPool(generator PersonaGenerator, sessionOptions SessionPoolOptions) *SessionPool[*azuretls.Session] {
+	return newSessionPool[*azuretls.Session](&azureTLSSessionBackend{}, generator, sessionOptions)
+}
+
+type azureTLSSessionBackend struct {
+	requestCounts sync.Map
+}
+
+func (b *azureTLSSessionBackend) newSession(impersonateOption ImpersonateOption) (*azuretls.Session, error) {
+	session, err := NewImpersonateAzureTLSsession(impersonateOption)
+	if err != nil {
+		return nil, err
+	}
+	requests := &atomic.Int64{}
+	b.requestCounts.Store(session, requests)
+	previousCallback := session.CallbackWithContext
+	session.CallbackWithContext = func(ctx *azuretls.Context) {
+		requests.Add(1)
+		if previousCallback != nil {
+			previousCallback(ctx)
+		}
+	}
+	return session, nil
+}
+
+func (b *azureTLSSessionBackend) requests(session *azuretls.Session) int64 {
+	if requests, ok := b.requestCounts.Load(session); ok {
+		return requests.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+func (b *azureTLSSessionBackend) closeIdleConnections(session *azuretls.Session) {
+	closeAzureTLSIdleConnections(session)
+}
+
+func (b *azureTLSSessionBackend) close(session *azuretls.Session) {
+	b.requestCounts.Delete(session)
+	CloseImpersonateAzureTLSsession(session)
+}
+
+func (b *azureTLSSessionBackend) proxy(session *azuretls.Session) string {
+	proxy := getAzureTLSProxy(weak.Make(session))
+	if proxy == nil {
+		// Sessions leased without being impersonated
+		return session.Proxy
+	}
+	return proxy.current().proxyURL
+}
+
+func (b *azureTLSSessionBackend) setProxy(session *azuretls.Session, proxyURL string) error {
+	proxy := getAzureTLSProxy(weak.Make(session))
+	if proxy == nil {
+		return errors.New("browser_impersonate: the azuretls session is not impersonated, its proxy is not rotated")
+	}
+	return proxy.set(session, proxyURL)
+}
+
+// azuretls supports every scheme of ProxySchemes
+func (b *azureTLSSessionBackend) proxySchemes() []string {
+	return nil
+}
+
+// DoAzureTLSWithRetry sends the request with the session of the lease, retrying the attempts options classify as blocked.
+// Requests with an io.Reader body are not retried, it cannot be replayed.
+// The lease returned is the one to release, a new one once RotatePersona renewed it, nil when renewing failed.
+func DoAzureTLSWithRetry(lease *SessionLease[*azuretls.Session], request *azuretls.Request, options RetryOptions) (*azuretls.Response, *SessionLease[*azuretls.Session], []RetryAttempt, error) {
+	ctx := request.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := request.Body.(io.Reader); ok {
+		options.MaxAttempts = 1
+	}
+	send := func(session *azuretls.Session) (*azuretls.Response, RetryResponse, error) {
+		// The pre-hook writes the generated headers in the request, each attempt starts from the original one
+		attempt := &azuretls.Request{
+			Method:             request.Method,
+			Url:                request.Url,
+			Body:               request.Body,
+			PHeader:            request.PHeader,
+			OrderedHeaders:     request.OrderedHeaders,
+			Header:             request.Header.Clone(),
+			HeaderOrder:        request.HeaderOrder,
+			DisableRedirects:   request.DisableRedirects,
+			MaxRedirects:       request.MaxRedirects,
+			NoCookie:           request.NoCookie,
+			TimeOut:            request.TimeOut,
+			InsecureSkipVerify: request.InsecureSkipVerify,
+			IgnoreBody:         request.IgnoreBody,
+			Proto:              request.Proto,
+			ForceHTTP1:         request.ForceHTTP1,
+			ForceHTTP3:         request.ForceHTTP3,
+			ContentLength:      request.ContentLength,
+		}
+		attempt.SetContext(ctx)
+		resp, err := session.Do(attempt)
+		if err != nil {
+			return nil, RetryResponse{}, err
+		}
+		return resp, RetryResponse{StatusCode: resp.StatusCode, Header: http.Header(resp.Header), Body: resp.Body[:min(len(resp.Body), retryBodyPeekSize)]}, nil
+	}
+	discard := func(resp *azuretls.Response) {
+		if resp != nil && resp.RawBody != nil {
+			resp.RawBody.Close()
+		}
+	}
+	return doWithRetry(ctx, options, lease, leaseRetryBackend[*azuretls.Session](lease, &azureTLSSessionBackend{}), send, discard)
+}
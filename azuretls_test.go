@@ -0,0 +1,226 @@
+//go:build !no_azuretls
+
+package browser_impersonate
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"weak"
+
+	"github.com/Noooste/azuretls-client"
+)
+
+func newAzureTLSTestSession(t *testing.T, impersonateOption ImpersonateOption) *azuretls.Session {
+	t.Helper()
+	session := azuretls.NewSession()
+	session.InsecureSkipVerify = true
+	if err := SetImpersonateAzureTLS(session, impersonateOption); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { CloseImpersonateAzureTLSsession(session) })
+	return session
+}
+
+func TestAzureTLSSessionStoreResumption(t *testing.T) {
+	var resumed []bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resumed = append(resumed, r.TLS.DidResume)
+	}))
+	// TLS 1.3 only resumes with pre_shared_key
+	server.TLS = &tls.Config{MinVersion: tls.VersionTLS13}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	store := NewTLSSessionStore()
+	session := newAzureTLSTestSession(t, ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, TLSSessionStore: store})
+	for range 2 {
+		if _, err := session.Get(server.URL); err != nil {
+			t.Fatal(err)
+		}
+		// The next request opens a new connection
+		server.CloseClientConnections()
+		session.HTTP2Transport.CloseIdleConnections()
+		session.Transport.CloseIdleConnections()
+	}
+	if store.Len() != 1 {
+		t.Fatalf("store has the tickets of %d servers, want 1", store.Len())
+	}
+	if len(resumed) != 2 || resumed[0] || !resumed[1] {
+		t.Fatalf("resumed connections %v, want [false true]", resumed)
+	}
+}
+
+// Serialized ECHConfig of a X25519 key, with the public name of the httptest certificate.
+func newTestECHConfig(t *testing.T, configID uint8) (*ecdh.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicName := "example.com"
+	contents := []byte{configID, 0x00, 0x20}
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(key.PublicKey().Bytes())))
+	contents = append(contents, key.PublicKey().Bytes()...)
+	// HKDF-SHA256 with AES-128-GCM
+	contents = append(contents, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01)
+	contents = append(contents, 0, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = append(contents, 0x00, 0x00)
+	config := binary.BigEndian.AppendUint16(nil, echConfigVersion)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	return key, append(config, contents...)
+}
+
+func TestAzureTLSECH(t *testing.T) {
+	serverKey, serverConfig := newTestECHConfig(t, 1)
+	_, staleConfig := newTestECHConfig(t, 2)
+	configList := func(config []byte) []byte {
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(config))), config...)
+	}
+
+	var accepted []bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = append(accepted, r.TLS.ECHAccepted)
+	}))
+	server.TLS = &tls.Config{
+		MinVersion:               tls.VersionTLS13,
+		EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{{Config: serverConfig, PrivateKey: serverKey.Bytes(), SendAsRetry: true}},
+	}
+	// The rejected handshakes are logged otherwise
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	target := "https://ech.example.com:" + port
+
+	tests := []struct {
+		name       string
+		configList []byte
+		accepted   []bool
+	}{
+		{name: "accepted", configList: configList(serverConfig), accepted: []bool{true, true}},
+		{name: "malformed sends GREASE", configList: []byte{0x00, 0x03, 0xfe, 0x0d, 0x00}, accepted: []bool{false, false}},
+		// The first request fails on the rejection, the second one sends GREASE ECH
+		{name: "rejected sends GREASE", configList: configList(staleConfig), accepted: []bool{false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accepted = nil
+			session := azuretls.NewSession()
+			session.InsecureSkipVerify = true
+			impersonateOption := ImpersonateOption{
+				OS:          Windows,
+				Browser:     ImpersonateBrowser{Type: BrowserChrome},
+				ECHResolver: ECHConfigList(test.configList),
+				Resolve:     map[string][]netip.Addr{"ech.example.com": {netip.MustParseAddr("127.0.0.1")}},
+			}
+			if err := SetImpersonateAzureTLS(session, impersonateOption); err != nil {
+				t.Fatal(err)
+			}
+			defer CloseImpersonateAzureTLSsession(session)
+			for range 2 {
+				session.Get(target)
+				server.CloseClientConnections()
+				session.HTTP2Transport.CloseIdleConnections()
+				session.Transport.CloseIdleConnections()
+			}
+			if !slices.Equal(accepted, test.accepted) {
+				t.Fatalf("ECH accepted %v, want %v", accepted, test.accepted)
+			}
+		})
+	}
+}
+
+func TestAzureTLSKeyExchange(t *testing.T) {
+	for _, test := range keyExchangeTests {
+		t.Run(test.name, func(t *testing.T) {
+			server, states := newTLSStateServer(t, &tls.Config{MinVersion: tls.VersionTLS13, CurvePreferences: test.serverGroups})
+			session := newAzureTLSTestSession(t, ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}})
+			if _, err := session.Get(server.URL); err != nil {
+				t.Fatal(err)
+			}
+			if state := states()[0]; state.CurveID != test.curveID {
+				t.Fatalf("got %v, want %v", state.CurveID, test.curveID)
+			}
+		})
+	}
+}
+
+func TestAzureTLSProxyRotation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	refusing, tunneling := newTestProxy(t, http.StatusForbidden), newTestProxy(t, http.StatusOK)
+	pool := newTestProxyPool(t, []string{refusing.URL, tunneling.URL}, ProxyPoolOptions{})
+	session := newAzureTLSTestSession(t, ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, ProxyPool: pool, ProxyKey: "persona"})
+	proxy := getAzureTLSProxy(weak.Make(session))
+	if proxyURL := proxy.current().proxyURL; proxyURL != refusing.URL {
+		t.Fatalf("got %q, want %q", proxyURL, refusing.URL)
+	}
+	// Requests failing at once on the first proxy move the session once
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() { session.Get(server.URL) })
+	}
+	wg.Wait()
+	if proxyURL := proxy.current().proxyURL; proxyURL != tunneling.URL {
+		t.Fatalf("got %q, want %q", proxyURL, tunneling.URL)
+	}
+	if stats := pool.Stats(); stats[0].Rotations != 1 || stats[1].Keys != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	if _, err := session.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	CloseImpersonateAzureTLSsession(session)
+	if keys := proxyKeys(pool); keys[0]+keys[1] != 0 || getAzureTLSProxy(weak.Make(session)) != nil {
+		t.Fatalf("got keys %v, want the proxy of the closed session released", keys)
+	}
+}
+
+func TestDoAzureTLSWithRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Sessions leased without being impersonated
+	session := azuretls.NewSession()
+	defer session.Close()
+	lease := NewSessionLease(session, ImpersonateOption{})
+	if _, _, _, err := DoAzureTLSWithRetry(lease, &azuretls.Request{Method: http.MethodGet, Url: server.URL}, RetryOptions{MaxAttempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&azureTLSSessionBackend{}).setProxy(session, "http://a.example:8080"); err == nil {
+		t.Fatal("got no error moving a session that is not impersonated")
+	}
+
+	// Requests sent by the retry count towards MaxRequests of the pool
+	pool := NewAzureTLSSessionPool(func() (ImpersonateOption, error) {
+		return ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}, nil
+	}, SessionPoolOptions{MaxRequests: 1})
+	defer pool.Shutdown(context.Background())
+	lease, err := pool.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, lease, _, err := DoAzureTLSWithRetry(lease, &azuretls.Request{Method: http.MethodGet, Url: server.URL}, RetryOptions{})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatal(err)
+	}
+	lease.Release()
+	if stats := pool.Stats(); stats != (SessionPoolStats{Created: 1, Retired: 1}) {
+		t.Fatalf("got %+v, want the session retired after MaxRequests", stats)
+	}
+}
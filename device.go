@@ -0,0 +1,119 @@
+package browser_impersonate
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+type DeviceClass int
+
+const (
+	DeviceDefault DeviceClass = iota // Phone on Android and iOS, desktop otherwise
+	DevicePhone
+	DeviceTablet
+)
+
+// ScreenClass is the CSS pixel size of the screen in portrait, and its device pixel ratio.
+type ScreenClass struct {
+	Width      int
+	Height     int
+	PixelRatio float64
+}
+
+// ImpersonateDevice describes the hardware of the persona, only used for mobile impersonation.
+type ImpersonateDevice struct {
+	Class     DeviceClass
+	Model     string // Sec-Ch-Ua-Model and WebView User-Agent model, "Pixel 8"
+	Build     string // Android build id as shown in WebView User-Agents, "AP4A.250105.002"
+	OSVersion string // OS version the device ships with, used when ImpersonateOption.OSVersion is not set
+	Screen    ScreenClass
+}
+
+var AndroidDevices = []ImpersonateDevice{
+	{Model: "Pixel 8", Build: "AP4A.250105.002", OSVersion: "15", Screen: ScreenClass{Width: 412, Height: 915, PixelRatio: 2.625}},
+	{Model: "Pixel 7", Build: "UQ1A.240205.004", OSVersion: "14", Screen: ScreenClass{Width: 412, Height: 915, PixelRatio: 2.625}},
+	{Model: "SM-S918B", Build: "UP1A.231005.007", OSVersion: "14", Screen: ScreenClass{Width: 384, Height: 824, PixelRatio: 3.75}},
+	{Model: "SM-A546B", Build: "UP1A.231005.007", OSVersion: "14", Screen: ScreenClass{Width: 384, Height: 854, PixelRatio: 2.8125}},
+	{Model: "SM-G991B", Build: "TP1A.220624.014", OSVersion: "13", Screen: ScreenClass{Width: 384, Height: 854, PixelRatio: 2.8125}},
+	{Model: "23021RAA2Y", Build: "TKQ1.221114.001", OSVersion: "13", Screen: ScreenClass{Width: 393, Height: 873, PixelRatio: 2.75}},
+	{Model: "moto g54 5G", Build: "U1TDS34.94-12-7-3", OSVersion: "14", Screen: ScreenClass{Width: 412, Height: 915, PixelRatio: 2.625}},
+}
+
+var AndroidTablets = []ImpersonateDevice{
+	{Class: DeviceTablet, Model: "SM-X710", Build: "UP1A.231005.007", OSVersion: "14", Screen: ScreenClass{Width: 800, Height: 1280, PixelRatio: 2}},
+	{Class: DeviceTablet, Model: "SM-X200", Build: "UP1A.231005.007", OSVersion: "14", Screen: ScreenClass{Width: 600, Height: 960, PixelRatio: 2}},
+	{Class: DeviceTablet, Model: "Pixel Tablet", Build: "AP4A.250105.002", OSVersion: "15", Screen: ScreenClass{Width: 800, Height: 1280, PixelRatio: 2}},
+}
+
+// iPads do not expose their model, only the screen differs.
+var IPadDevices = []ImpersonateDevice{
+	{Class: DeviceTablet, Screen: ScreenClass{Width: 820, Height: 1180, PixelRatio: 2}},
+	{Class: DeviceTablet, Screen: ScreenClass{Width: 834, Height: 1194, PixelRatio: 2}},
+	{Class: DeviceTablet, Screen: ScreenClass{Width: 1032, Height: 1376, PixelRatio: 2}},
+}
+
+// Pick random Android phone
+func GetRandomAndroidDevice() ImpersonateDevice {
+	return AndroidDevices[rand.Intn(len(AndroidDevices))]
+}
+
+// Samsung Internet is preinstalled on Galaxy phones, where most of its users are.
+func GetRandomSamsungDevice() ImpersonateDevice {
+	samsungDevices := []ImpersonateDevice{}
+	for _, device := range AndroidDevices {
+		if strings.HasPrefix(device.Model, "SM-") {
+			samsungDevices = append(samsungDevices, device)
+		}
+	}
+	return samsungDevices[rand.Intn(len(samsungDevices))]
+}
+
+// IsTablet reports whether the persona is an iPad or an Android tablet.
+func (o ImpersonateOption) IsTablet() bool {
+	return o.OS.IsMobile() && o.Device.Class == DeviceTablet
+}
+
+// IsMobile reports whether the browser presents itself as mobile, tablets do not.
+func (o ImpersonateOption) IsMobile() bool {
+	return o.OS.IsMobile() && !o.IsTablet()
+}
+
+// GetSecChUaModel returns the Sec-Ch-Ua-Model value, empty quotes on desktop.
+func GetSecChUaModel(impersonateOption ImpersonateOption) string {
+	return fmt.Sprintf("%q", impersonateOption.Device.Model)
+}
+
+// GetAndroidWebViewUserAgent returns the User-Agent of the Android System WebView, which is not reduced like Chrome's.
+func GetAndroidWebViewUserAgent(impersonateOption ImpersonateOption) string {
+	version := impersonateOption.Browser.Version
+	if version == 0 {
+		version = LatestChromeVersion
+	}
+	device := impersonateOption.Device.Model
+	if device == "" {
+		device = "K"
+	} else if impersonateOption.Device.Build != "" {
+		device = device + " Build/" + impersonateOption.Device.Build
+	}
+	mobileToken := "Mobile "
+	if impersonateOption.IsTablet() {
+		mobileToken = ""
+	}
+	return fmt.Sprintf("Mozilla/5.0 (Linux; Android %s; %s; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/%s %sSafari/537.36",
+		formatOSVersion(impersonateOption.GetOSVersion(), 1, "."),
+		device,
+		GetChromeFullVersion(version),
+		mobileToken,
+	)
+}
+
+// Screen related client hints, only sent when the server asked for them.
+func headerScreenHints(headers AnyHttpHeader, screen ScreenClass) {
+	if screen.Width == 0 {
+		return
+	}
+	headers.Set("Sec-Ch-Viewport-Width", strconv.Itoa(screen.Width))
+	headers.Set("Sec-Ch-Dpr", strconv.FormatFloat(screen.PixelRatio, 'f', -1, 64))
+}
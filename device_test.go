@@ -0,0 +1,184 @@
+package browser_impersonate
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetAndroidWebViewUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   string
+	}{
+		{
+			name:   "pixel 8",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, Device: AndroidDevices[0]},
+			want:   "Mozilla/5.0 (Linux; Android 15; Pixel 8 Build/AP4A.250105.002; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/142.0.7444.46 Mobile Safari/537.36",
+		},
+		{
+			name:   "model without build",
+			option: ImpersonateOption{OS: Android, OSVersion: "14", Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 140}, Device: ImpersonateDevice{Model: "SM-S918B"}},
+			want:   "Mozilla/5.0 (Linux; Android 14; SM-S918B; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/140.0.7339.80 Mobile Safari/537.36",
+		},
+		{
+			name:   "no device",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want:   "Mozilla/5.0 (Linux; Android 15; K; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/142.0.7444.46 Mobile Safari/537.36",
+		},
+	}
+	for _, test := range tests {
+		if got := GetAndroidWebViewUserAgent(test.option); got != test.want {
+			t.Errorf("%s: GetAndroidWebViewUserAgent() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetOSVersionFromDevice(t *testing.T) {
+	option := ImpersonateOption{OS: Android, Device: ImpersonateDevice{Model: "Pixel 7", OSVersion: "14"}}
+	if got := option.GetOSVersion(); got != "14" {
+		t.Errorf("GetOSVersion() = %q, want the OSVersion of the device", got)
+	}
+	option.OSVersion = "15"
+	if got := option.GetOSVersion(); got != "15" {
+		t.Errorf("GetOSVersion() = %q, want OSVersion over the one of the device", got)
+	}
+}
+
+func TestImpersonateHeadersDevice(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name: "webview",
+			option: ImpersonateOption{
+				OS:               Android,
+				Browser:          ImpersonateBrowser{Type: BrowserChrome, Version: 142},
+				Device:           AndroidDevices[0],
+				WebView:          true,
+				WebViewPackage:   "com.example.app",
+				HighEntropyHints: true,
+			},
+			want: map[string]string{
+				"Sec-Ch-Ua":                   `"Chromium";v="142", "Android WebView";v="142", "Not_A Brand";v="99"`,
+				"Sec-Ch-Ua-Full-Version-List": `"Chromium";v="142.0.7444.46", "Android WebView";v="142.0.7444.46", "Not_A Brand";v="99.0.0.0"`,
+				"Sec-Ch-Ua-Platform-Version":  `"15.0.0"`,
+				"Sec-Ch-Ua-Model":             `"Pixel 8"`,
+				"Sec-Ch-Viewport-Width":       "412",
+				"Sec-Ch-Dpr":                  "2.625",
+				"X-Requested-With":            "com.example.app",
+			},
+		},
+		{
+			name:   "chrome on android without high entropy hints",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, Device: AndroidDevices[0]},
+			want: map[string]string{
+				"Sec-Ch-Ua":             `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`,
+				"Sec-Ch-Ua-Model":       "",
+				"Sec-Ch-Viewport-Width": "",
+				"X-Requested-With":      "",
+			},
+		},
+		{
+			name:   "desktop chrome",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, HighEntropyHints: true},
+			want: map[string]string{
+				"Sec-Ch-Ua-Model":       `""`,
+				"Sec-Ch-Viewport-Width": "",
+				"Sec-Ch-Dpr":            "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsTablet(t *testing.T) {
+	tests := []struct {
+		name       string
+		option     ImpersonateOption
+		wantTablet bool
+		wantMobile bool
+	}{
+		{name: "desktop", option: ImpersonateOption{OS: Windows}},
+		{name: "phone", option: ImpersonateOption{OS: Android, Device: AndroidDevices[0]}, wantMobile: true},
+		{name: "android tablet", option: ImpersonateOption{OS: Android, Device: AndroidTablets[0]}, wantTablet: true},
+		{name: "ipad", option: ImpersonateOption{OS: IOS, Device: IPadDevices[0]}, wantTablet: true},
+		{name: "tablet class on desktop", option: ImpersonateOption{OS: MacOS, Device: ImpersonateDevice{Class: DeviceTablet}}},
+	}
+	for _, test := range tests {
+		if got := test.option.IsTablet(); got != test.wantTablet {
+			t.Errorf("%s: IsTablet() = %t, want %t", test.name, got, test.wantTablet)
+		}
+		if got := test.option.IsMobile(); got != test.wantMobile {
+			t.Errorf("%s: IsMobile() = %t, want %t", test.name, got, test.wantMobile)
+		}
+	}
+}
+
+func TestImpersonateHeadersTablet(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name:   "chrome on android tablet",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, Device: AndroidTablets[0]},
+			want: map[string]string{
+				"User-Agent":       "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
+				"Sec-Ch-Ua-Mobile": "?0",
+			},
+		},
+		{
+			name:   "webview on android tablet",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, Device: AndroidTablets[2], WebView: true, WebViewPackage: "com.example.app"},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Linux; Android 15; Pixel Tablet Build/AP4A.250105.002; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/142.0.7444.46 Safari/537.36",
+			},
+		},
+		{
+			name:   "firefox on android tablet",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserFirefox, Version: 145}, Device: AndroidTablets[0]},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Android 14; Tablet; rv:145.0) Gecko/145.0 Firefox/145.0",
+			},
+		},
+		{
+			name:   "safari on ipad",
+			option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 18}, Device: IPadDevices[0]},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.7 Safari/605.1.15",
+			},
+		},
+		{
+			name:   "chrome on ipad",
+			option: ImpersonateOption{OS: IOS, OSVersion: "17.5", Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, Device: IPadDevices[0]},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/142.0.7444.46 Mobile/15E148 Safari/604.1",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
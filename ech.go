@@ -0,0 +1,204 @@
+package browser_impersonate
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ECHConfig version deployed since draft 13, the only one the utls forks encrypt to.
+const echConfigVersion uint16 = 0xfe0d
+
+// ECHConfigResolver looks up the ECHConfigList a server publishes, in the ech parameter of its HTTPS DNS record.
+// A nil list means the server publishes none, GREASE ECH is sent then.
+// Lookup errors fall back to GREASE ECH as well, as browsers do when the HTTPS record cannot be resolved.
+type ECHConfigResolver interface {
+	LookupECHConfigList(ctx context.Context, host string) ([]byte, error)
+}
+
+// ECHConfigList is a serialized ECHConfigList used for every server, when talking to a single known one.
+type ECHConfigList []byte
+
+func (l ECHConfigList) LookupECHConfigList(ctx context.Context, host string) ([]byte, error) {
+	return l, nil
+}
+
+// StaticECHConfigs maps host names to the serialized ECHConfigList they publish.
+type StaticECHConfigs map[string][]byte
+
+func (s StaticECHConfigs) LookupECHConfigList(ctx context.Context, host string) ([]byte, error) {
+	return s[strings.ToLower(strings.TrimSuffix(host, "."))], nil
+}
+
+// UsesECH reports whether the browser sends real ECH to servers publishing an ECH config.
+// Chrome enabled ECH in 117 and Firefox in 118, Firefox only resolves HTTPS records over DoH,
+// which Tor Browser does not use. Safari and the native apps only send GREASE ECH, if any.
+// Only azuretls sends real ECH, tls-client builds its tls.Config itself and keeps the GREASE ECH of its profiles.
+func UsesECH(impersonateOption ImpersonateOption) bool {
+	switch {
+	case impersonateOption.Browser.Type.IsNativeApp() || impersonateOption.UsesWebKit():
+		return false
+	case impersonateOption.Browser.Type == BrowserTorBrowser:
+		return false
+	case impersonateOption.Browser.Type.IsGecko():
+		return GetGeckoVersion(impersonateOption.Browser) >= 118
+	default:
+		version := impersonateOption.Browser.Version
+		if version == 0 {
+			version = GetLatestVersion(impersonateOption.Browser.Type)
+		}
+		return version >= 117
+	}
+}
+
+// GetECHConfigList returns the ECHConfigList to encrypt the ClientHello to host with, nil to send GREASE ECH.
+// Without an ECHResolver the configs come from the HTTPS records of the persona resolver.
+// Lists without a config the utls forks can encrypt to, malformed ones included, get GREASE ECH instead of a failed handshake.
+func GetECHConfigList(ctx context.Context, impersonateOption ImpersonateOption, host string) []byte {
+	echResolver := impersonateOption.ECHResolver
+	if resolver := GetResolver(impersonateOption); echResolver == nil && resolver != nil {
+		echResolver = HTTPSRecordECHConfigs{Resolver: resolver}
+	}
+	if echResolver == nil || !UsesECH(impersonateOption) {
+		return nil
+	}
+	configList, err := echResolver.LookupECHConfigList(ctx, host)
+	if err != nil || !isUsableECHConfigList(configList) {
+		return nil
+	}
+	return configList
+}
+
+// Reports whether the list is well formed with a config the utls forks can encrypt to, they fail the handshake otherwise.
+func isUsableECHConfigList(configList []byte) bool {
+	if len(configList) < 2 || int(binary.BigEndian.Uint16(configList)) != len(configList)-2 {
+		return false
+	}
+	usableConfig := false
+	for configs := configList[2:]; len(configs) > 0; {
+		if len(configs) < 4 || len(configs) < 4+int(binary.BigEndian.Uint16(configs[2:])) {
+			return false
+		}
+		version, contents := binary.BigEndian.Uint16(configs), configs[4:4+int(binary.BigEndian.Uint16(configs[2:]))]
+		configs = configs[4+len(contents):]
+		if version != echConfigVersion {
+			continue
+		}
+		usable, ok := parseECHConfigContents(contents)
+		if !ok {
+			return false
+		}
+		usableConfig = usableConfig || usable
+	}
+	return usableConfig
+}
+
+// Parses the contents of an ECHConfig, usable when the forks support its KEM, one of its cipher suites and its extensions:
+// X25519, HKDF-SHA256 with AES-GCM or ChaCha20Poly1305, and no mandatory extension.
+func parseECHConfigContents(contents []byte) (usable bool, ok bool) {
+	read := func(n int) ([]byte, bool) {
+		if len(contents) < n {
+			return nil, false
+		}
+		field := contents[:n]
+		contents = contents[n:]
+		return field, true
+	}
+	readVector := func(lengthSize int) ([]byte, bool) {
+		header, ok := read(lengthSize)
+		if !ok {
+			return nil, false
+		}
+		length := 0
+		for _, b := range header {
+			length = length<<8 | int(b)
+		}
+		return read(length)
+	}
+	header, ok := read(3)
+	if !ok {
+		return false, false
+	}
+	kemID := binary.BigEndian.Uint16(header[1:])
+	if _, ok := readVector(2); !ok {
+		return false, false
+	}
+	cipherSuites, ok := readVector(2)
+	if !ok || len(cipherSuites)%4 != 0 {
+		return false, false
+	}
+	if _, ok := read(1); !ok {
+		return false, false
+	}
+	name, ok := readVector(1)
+	if !ok {
+		return false, false
+	}
+	extensions, ok := readVector(2)
+	if !ok {
+		return false, false
+	}
+
+	usable = kemID == 0x0020 && len(name) > 0 && net.ParseIP(string(name)) == nil
+	supportedSuite := false
+	for ; len(cipherSuites) > 0; cipherSuites = cipherSuites[4:] {
+		kdfID, aeadID := binary.BigEndian.Uint16(cipherSuites), binary.BigEndian.Uint16(cipherSuites[2:])
+		supportedSuite = supportedSuite || kdfID == 0x0001 && aeadID >= 0x0001 && aeadID <= 0x0003
+	}
+	for len(extensions) > 0 {
+		if len(extensions) < 4 || len(extensions) < 4+int(binary.BigEndian.Uint16(extensions[2:])) {
+			return false, false
+		}
+		// The high bit marks the extensions a client must understand to use the config
+		usable = usable && binary.BigEndian.Uint16(extensions)&0x8000 == 0
+		extensions = extensions[4+int(binary.BigEndian.Uint16(extensions[2:])):]
+	}
+	return usable && supportedSuite, true
+}
+
+// ECH configs of the hosts a session connects to. They are looked up with the context of the requests,
+// the TLS config hooks of the backends only get the server name.
+type echConfigCache struct {
+	mu          sync.Mutex
+	configLists map[string][]byte
+	rejected    map[string][]byte
+}
+
+// lookup fetches the config list of host before a request to it, nil when GREASE ECH is sent.
+func (c *echConfigCache) lookup(ctx context.Context, impersonateOption ImpersonateOption, host string) {
+	configList := GetECHConfigList(ctx, impersonateOption, host)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.configLists == nil {
+		c.configLists = map[string][]byte{}
+	}
+	c.configLists[normalizeHost(host)] = configList
+}
+
+// get returns the config list to encrypt the next ClientHello to host with.
+// A list the server rejected gets GREASE ECH until the lookups return another one.
+func (c *echConfigCache) get(host string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host = normalizeHost(host)
+	configList := c.configLists[host]
+	if rejected, ok := c.rejected[host]; ok && bytes.Equal(rejected, configList) {
+		return nil
+	}
+	return configList
+}
+
+// reject records the config list host rejected ECH with.
+// Its retry configs are not used: they are only trusted along with the certificate of the public name,
+// which the utls forks do not hand to EncryptedClientHelloRejectionVerify.
+func (c *echConfigCache) reject(host string, configList []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rejected == nil {
+		c.rejected = map[string][]byte{}
+	}
+	c.rejected[normalizeHost(host)] = configList
+}
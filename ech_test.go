@@ -0,0 +1,124 @@
+package browser_impersonate
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+// Builds an ECHConfigList of one config, X25519 with the given cipher suite, public name and extensions.
+func newECHConfigList(version uint16, kemID uint16, kdfID uint16, aeadID uint16, publicName string, extensions []byte) []byte {
+	contents := []byte{1}
+	contents = binary.BigEndian.AppendUint16(contents, kemID)
+	contents = binary.BigEndian.AppendUint16(contents, 32)
+	contents = append(contents, make([]byte, 32)...)
+	contents = binary.BigEndian.AppendUint16(contents, 4)
+	contents = binary.BigEndian.AppendUint16(contents, kdfID)
+	contents = binary.BigEndian.AppendUint16(contents, aeadID)
+	contents = append(contents, 0, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(extensions)))
+	contents = append(contents, extensions...)
+	config := binary.BigEndian.AppendUint16(nil, version)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(config))), config...)
+}
+
+func TestUsesECH(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   bool
+	}{
+		{name: "chrome", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}, want: true},
+		{name: "chrome 116", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 116}}, want: false},
+		{name: "firefox", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}, want: true},
+		{name: "firefox esr 115", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 115}}, want: false},
+		{name: "tor browser", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserTorBrowser}}, want: false},
+		{name: "safari", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}}, want: false},
+		{name: "chrome on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserChrome}}, want: false},
+		{name: "okhttp", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}}, want: false},
+	}
+	for _, test := range tests {
+		if got := UsesECH(test.option); got != test.want {
+			t.Errorf("%s: UsesECH() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsUsableECHConfigList(t *testing.T) {
+	usable := newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0001, "example.com", nil)
+	unknownVersion := newECHConfigList(0xfe0a, 0x0020, 0x0001, 0x0001, "example.com", nil)
+	tests := []struct {
+		name       string
+		configList []byte
+		want       bool
+	}{
+		{name: "usable", configList: usable, want: true},
+		{name: "chacha20poly1305", configList: newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0003, "example.com", nil), want: true},
+		{name: "optional extension", configList: newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0001, "example.com", []byte{0x00, 0x01, 0x00, 0x00}), want: true},
+		{name: "P-256", configList: newECHConfigList(echConfigVersion, 0x0010, 0x0001, 0x0001, "example.com", nil)},
+		{name: "HKDF-SHA384", configList: newECHConfigList(echConfigVersion, 0x0020, 0x0002, 0x0001, "example.com", nil)},
+		{name: "mandatory extension", configList: newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0001, "example.com", []byte{0x80, 0x01, 0x00, 0x00})},
+		{name: "IP public name", configList: newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0001, "192.0.2.1", nil)},
+		{name: "unknown version", configList: unknownVersion},
+		{name: "unknown version first", configList: append(binary.BigEndian.AppendUint16(nil, uint16(len(unknownVersion)+len(usable)-4)), append(unknownVersion[2:], usable[2:]...)...), want: true},
+		{name: "truncated", configList: usable[:len(usable)-1]},
+		{name: "empty", configList: nil},
+	}
+	for _, test := range tests {
+		if got := isUsableECHConfigList(test.configList); got != test.want {
+			t.Errorf("%s: isUsableECHConfigList() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetECHConfigList(t *testing.T) {
+	usable := newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0001, "example.com", nil)
+	chrome := ImpersonateBrowser{Type: BrowserChrome}
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		host   string
+		want   []byte
+	}{
+		{name: "no resolver", option: ImpersonateOption{OS: Windows, Browser: chrome}, host: "example.com"},
+		{name: "config list", option: ImpersonateOption{OS: Windows, Browser: chrome, ECHResolver: ECHConfigList(usable)}, host: "example.com", want: usable},
+		{name: "malformed list", option: ImpersonateOption{OS: Windows, Browser: chrome, ECHResolver: ECHConfigList{0x00, 0x01, 0x00}}, host: "example.com"},
+		{name: "safari", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}, ECHResolver: ECHConfigList(usable)}, host: "example.com"},
+		{name: "static configs", option: ImpersonateOption{OS: Windows, Browser: chrome, ECHResolver: StaticECHConfigs{"example.com": usable}}, host: "Example.COM.", want: usable},
+		{name: "static configs of another host", option: ImpersonateOption{OS: Windows, Browser: chrome, ECHResolver: StaticECHConfigs{"example.com": usable}}, host: "example.net"},
+	}
+	for _, test := range tests {
+		if got := GetECHConfigList(context.Background(), test.option, test.host); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: GetECHConfigList() = %x, want %x", test.name, got, test.want)
+		}
+	}
+}
+
+func TestECHConfigCache(t *testing.T) {
+	first := newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0001, "example.com", nil)
+	second := newECHConfigList(echConfigVersion, 0x0020, 0x0001, 0x0003, "example.com", nil)
+	option := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}
+	cache := &echConfigCache{}
+
+	option.ECHResolver = ECHConfigList(first)
+	cache.lookup(context.Background(), option, "Example.com")
+	if got := cache.get("example.com."); !bytes.Equal(got, first) {
+		t.Fatalf("get() = %x, want the looked up list", got)
+	}
+	cache.reject("example.com", first)
+	if got := cache.get("example.com"); got != nil {
+		t.Fatalf("get() = %x after the list was rejected, want GREASE ECH", got)
+	}
+	option.ECHResolver = ECHConfigList(second)
+	cache.lookup(context.Background(), option, "example.com")
+	if got := cache.get("example.com"); !bytes.Equal(got, second) {
+		t.Fatalf("get() = %x, want the new list", got)
+	}
+	if got := cache.get("example.net"); got != nil {
+		t.Fatalf("get() = %x for a host never looked up", got)
+	}
+}
@@ -5,15 +5,16 @@ go 1.25.4
 require (
 	github.com/Noooste/azuretls-client v1.12.9
 	github.com/Noooste/fhttp v1.0.15
+	github.com/Noooste/go-socks4 v0.0.2
+	github.com/Noooste/utls v1.3.20
 	github.com/bogdanfinn/fhttp v0.6.3
 	github.com/bogdanfinn/tls-client v1.11.2
 	github.com/bogdanfinn/utls v1.7.4-barnius
+	golang.org/x/net v0.47.0
 )
 
 require (
-	github.com/Noooste/go-socks4 v0.0.2 // indirect
 	github.com/Noooste/uquic-go v1.0.1 // indirect
-	github.com/Noooste/utls v1.3.20 // indirect
 	github.com/Noooste/websocket v1.0.3 // indirect
 	github.com/andybalholm/brotli v1.2.0 // indirect
 	github.com/bdandy/go-errors v1.2.2 // indirect
@@ -34,7 +35,6 @@ require (
 	go.uber.org/mock v0.5.2 // indirect
 	golang.org/x/crypto v0.45.0 // indirect
 	golang.org/x/mod v0.29.0 // indirect
-	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sync v0.18.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
@@ -0,0 +1,98 @@
+package browser_impersonate
+
+import (
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// GetHTTP1HeaderName returns the casing the browser writes a header name with on HTTP/1.1 connections,
+// HTTP/2 lowercases every name anyway.
+func GetHTTP1HeaderName(impersonateOption ImpersonateOption, key string) string {
+	for _, name := range GetHTTP1HeaderOrder(impersonateOption) {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+	return textproto.CanonicalMIMEHeaderKey(key)
+}
+
+// ImpersonateHTTP1Headers rewrites headers generated for HTTP/2 to their HTTP/1.1 wire form:
+// names get the browser casing, Connection is added, and the headers only sent over HTTP/2 are dropped.
+// Names set with a non canonical casing are left as they are, the caller chose them.
+func ImpersonateHTTP1Headers(h map[string][]string, impersonateOption ImpersonateOption) {
+	isOverwritten := func(key string) bool {
+		for k := range impersonateOption.OverwriteHeaders {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+		return false
+	}
+	hasConnection := false
+	for key, values := range h {
+		switch {
+		case strings.EqualFold(key, "Connection"):
+			hasConnection = true
+		case strings.EqualFold(key, "te") && !isOverwritten(key):
+			// Trailers are only announced on HTTP/2
+			delete(h, key)
+			continue
+		case strings.EqualFold(key, "Priority") && !impersonateOption.Browser.Type.IsGecko() && !isOverwritten(key):
+			// Only Firefox sends the RFC 9218 Priority header over HTTP/1.1
+			delete(h, key)
+			continue
+		}
+		if key != textproto.CanonicalMIMEHeaderKey(key) {
+			continue
+		}
+		if name := GetHTTP1HeaderName(impersonateOption, key); name != key {
+			delete(h, key)
+			h[name] = values
+		}
+	}
+	if !hasConnection {
+		connection := "keep-alive"
+		if impersonateOption.Browser.Type == BrowserOkHttp {
+			connection = "Keep-Alive"
+		}
+		h[GetHTTP1HeaderName(impersonateOption, "Connection")] = []string{connection}
+	}
+}
+
+// GetHTTP1HeaderOrderKey returns GetHTTP1HeaderOrder lowercased, as the fhttp header sorters expect it.
+func GetHTTP1HeaderOrderKey(impersonateOption ImpersonateOption) []string {
+	order := GetHTTP1HeaderOrder(impersonateOption)
+	lower := make([]string, len(order))
+	for i, name := range order {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// HTTP major version negotiated with each https origin, learned from the responses.
+// Both backends keep talking to an origin with the protocol ALPN picked on the first connection,
+// the headers of the next requests are written in its form before they are handed to the transport.
+type negotiatedProtocols struct {
+	protoMajors sync.Map
+}
+
+// usesHTTP1 reports whether requests to the target go over HTTP/1.1, known is false until an https origin answered.
+func (p *negotiatedProtocols) usesHTTP1(target *url.URL) (http1 bool, known bool) {
+	if target.Scheme == "http" {
+		return true, true
+	}
+	protoMajor, ok := p.protoMajors.Load(target.Host)
+	if !ok {
+		return false, false
+	}
+	return protoMajor.(int) == 1, true
+}
+
+func (p *negotiatedProtocols) learn(target *url.URL, protoMajor int) {
+	if target == nil || target.Scheme != "https" || protoMajor == 0 {
+		return
+	}
+	p.protoMajors.Store(target.Host, protoMajor)
+}
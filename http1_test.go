@@ -0,0 +1,154 @@
+package browser_impersonate
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGetHTTP1HeaderName(t *testing.T) {
+	chrome := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}
+	firefox := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		key    string
+		want   string
+	}{
+		{name: "chrome client hint", option: chrome, key: "Sec-Ch-Ua-Mobile", want: "sec-ch-ua-mobile"},
+		{name: "chrome gpc", option: chrome, key: "sec-gpc", want: "Sec-GPC"},
+		{name: "chrome user agent", option: chrome, key: "user-agent", want: "User-Agent"},
+		{name: "firefox priority", option: firefox, key: "priority", want: "Priority"},
+		{name: "unknown header", option: chrome, key: "x-custom-header", want: "X-Custom-Header"},
+	}
+	for _, test := range tests {
+		if got := GetHTTP1HeaderName(test.option, test.key); got != test.want {
+			t.Errorf("%s: GetHTTP1HeaderName(%q) = %q, want %q", test.name, test.key, got, test.want)
+		}
+	}
+}
+
+func TestImpersonateHTTP1Headers(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string][]string
+	}{
+		{
+			name:   "chrome",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want: map[string][]string{
+				"Connection":         {"keep-alive"},
+				"sec-ch-ua-mobile":   {"?0"},
+				"sec-ch-ua-platform": {`"Windows"`},
+				"User-Agent":         {"Mozilla/5.0"},
+				"Accept-Language":    {"en-US,en;q=0.9"},
+				"x-lower":            {"kept"},
+			},
+		},
+		{
+			name:   "firefox",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}},
+			want: map[string][]string{
+				"Connection":         {"keep-alive"},
+				"Sec-Ch-Ua-Mobile":   {"?0"},
+				"Sec-Ch-Ua-Platform": {`"Windows"`},
+				"User-Agent":         {"Mozilla/5.0"},
+				"Accept-Language":    {"en-US,en;q=0.9"},
+				"Priority":           {"u=0, i"},
+				"x-lower":            {"kept"},
+			},
+		},
+		{
+			name:   "overwritten te",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, OverwriteHeaders: map[string]string{"te": "trailers"}},
+			want: map[string][]string{
+				"Connection":         {"keep-alive"},
+				"sec-ch-ua-mobile":   {"?0"},
+				"sec-ch-ua-platform": {`"Windows"`},
+				"User-Agent":         {"Mozilla/5.0"},
+				"Accept-Language":    {"en-US,en;q=0.9"},
+				"Te":                 {"trailers"},
+				"x-lower":            {"kept"},
+			},
+		},
+		{
+			name:   "okhttp",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}},
+			want: map[string][]string{
+				"Connection":         {"Keep-Alive"},
+				"Sec-Ch-Ua-Mobile":   {"?0"},
+				"Sec-Ch-Ua-Platform": {`"Windows"`},
+				"User-Agent":         {"Mozilla/5.0"},
+				"Accept-Language":    {"en-US,en;q=0.9"},
+				"x-lower":            {"kept"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := map[string][]string{
+				"Sec-Ch-Ua-Mobile":   {"?0"},
+				"Sec-Ch-Ua-Platform": {`"Windows"`},
+				"User-Agent":         {"Mozilla/5.0"},
+				"Accept-Language":    {"en-US,en;q=0.9"},
+				"Priority":           {"u=0, i"},
+				"Te":                 {"trailers"},
+				"x-lower":            {"kept"},
+			}
+			ImpersonateHTTP1Headers(h, test.option)
+			if !reflect.DeepEqual(h, test.want) {
+				t.Errorf("ImpersonateHTTP1Headers() = %q, want %q", h, test.want)
+			}
+		})
+	}
+}
+
+func TestImpersonateHTTP1HeadersKeepsConnection(t *testing.T) {
+	h := http.Header{"Connection": {"close"}}
+	ImpersonateHTTP1Headers(h, ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}})
+	if got := h.Get("Connection"); got != "close" {
+		t.Errorf("Connection = %q, want %q", got, "close")
+	}
+}
+
+func TestNegotiatedProtocols(t *testing.T) {
+	parse := func(rawURL string) *url.URL {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	protocols := &negotiatedProtocols{}
+	protocols.learn(parse("https://h1.example.com/"), 1)
+	protocols.learn(parse("https://h2.example.com/"), 2)
+	protocols.learn(parse("http://plain.example.com/"), 1)
+	protocols.learn(parse("https://unknown.example.com/"), 0)
+	tests := []struct {
+		target string
+		http1  bool
+		known  bool
+	}{
+		{target: "https://h1.example.com/path", http1: true, known: true},
+		{target: "https://h2.example.com/", http1: false, known: true},
+		{target: "https://h2.example.com:8443/", http1: false, known: false},
+		{target: "https://unknown.example.com/", http1: false, known: false},
+		{target: "http://plain.example.com/", http1: true, known: true},
+		{target: "http://other.example.com/", http1: true, known: true},
+	}
+	for _, test := range tests {
+		http1, known := protocols.usesHTTP1(parse(test.target))
+		if http1 != test.http1 || known != test.known {
+			t.Errorf("usesHTTP1(%q) = %v, %v, want %v, %v", test.target, http1, known, test.http1, test.known)
+		}
+	}
+}
+
+func TestGetHTTP1HeaderOrderKey(t *testing.T) {
+	want := []string{"host", "connection", "accept-encoding", "user-agent"}
+	if got := GetHTTP1HeaderOrderKey(ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetHTTP1HeaderOrderKey() = %q, want %q", got, want)
+	}
+}
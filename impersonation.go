@@ -3,6 +3,8 @@ package browser_impersonate
 import (
 	"fmt"
 	"math/rand"
+	"net/netip"
+	"net/textproto"
 	"strings"
 )
 
@@ -16,8 +18,46 @@ const (
 	BrowserOpera   BrowserType = "opera"
 	BrowserChrome  BrowserType = "chrome"
 	BrowserSafari  BrowserType = "safari"
+
+	BrowserVivaldi    BrowserType = "vivaldi"
+	BrowserSamsung    BrowserType = "samsung"
+	BrowserYandex     BrowserType = "yandex"
+	BrowserDuckDuckGo BrowserType = "duckduckgo"
+
+	BrowserFirefoxESR BrowserType = "firefox_esr"
+	BrowserTorBrowser BrowserType = "tor"
+
+	// Native mobile app HTTP clients
+	BrowserOkHttp    BrowserType = "okhttp"
+	BrowserCFNetwork BrowserType = "cfnetwork"
 )
 
+// IsGecko reports whether the browser is Firefox or one of its derivatives, iOS aside.
+func (b BrowserType) IsGecko() bool {
+	return b == BrowserFirefox || b == BrowserFirefoxESR || b == BrowserTorBrowser
+}
+
+// IsChromium reports whether the browser is built on Chromium, and so shares Chrome's network stack.
+// DuckDuckGo is only Chromium on Android, where it is built on the System WebView.
+func (b BrowserType) IsChromium() bool {
+	switch b {
+	case BrowserChrome, BrowserEdge, BrowserBrave, BrowserOpera, BrowserVivaldi, BrowserSamsung, BrowserYandex, BrowserDuckDuckGo:
+		return true
+	default:
+		return false
+	}
+}
+
+// SendsGPC reports whether the browser sends the Global Privacy Control signal by default, Sec-GPC.
+func (b BrowserType) SendsGPC() bool {
+	return b == BrowserBrave || b == BrowserDuckDuckGo
+}
+
+// UsesWebKit reports whether the persona runs on WebKit, Safari and every browser on iOS.
+func (o ImpersonateOption) UsesWebKit() bool {
+	return o.Browser.Type == BrowserSafari || o.OS == IOS
+}
+
 const (
 	Windows ImpersonateOS = iota
 	Linux
@@ -58,12 +98,28 @@ type ImpersonateBrowser struct {
 
 type ImpersonateOption struct {
 	OS                ImpersonateOS
+	OSVersion         string // Optional, "11" on Windows, "18.7" on iOS, "15" on Android... defaults to DefaultOSVersions
 	OverwriteHeaders  map[string]string
 	Browser           ImpersonateBrowser
+	Locales           []string // Optional BCP 47 language tags, most preferred first
+	Country           string   // Optional ISO 3166-1 alpha-2 code, picks default Locales when they are not set
 	SkipHeaders       bool
 	SkipHTTP2Settings bool
 	SkipPHeaderOrder  bool
 	SkipHeaderOrder   bool
+	HighEntropyHints  bool // Send the high entropy client hints, as Chromium does after the server asked for them with Accept-CH
+	Device            ImpersonateDevice
+	WebView           bool   // Android System WebView embedded in an app instead of Chrome, needs WebViewPackage
+	WebViewPackage    string // Package name of the embedding app, sent as X-Requested-With
+	App               ImpersonateApp
+	TLSExtensionSeed  int64                   // Seed of the Chromium TLS extension order, picked at random per session when 0
+	TLSSessionStore   *TLSSessionStore        // Session tickets to resume TLS sessions with, a new store per session when nil. azuretls only, tls-client keeps a cache of its own per client and rejects it
+	ECHResolver       ECHConfigResolver       // Looks up the ECH configs of servers, only GREASE ECH is sent when nil. azuretls only, tls-client rejects it
+	Resolver          Resolver                // Resolves hosts and their HTTPS records, the backend resolver without HTTPS records when nil. tls-client only takes the addresses, HTTPS records pick HTTP/3 and ECH on azuretls
+	Resolve           map[string][]netip.Addr // Addresses of hosts used instead of resolving them, as curl --resolve for every port
+	TCPFingerprint    bool                    // Give direct connections the TTL, MSS and window scale of the OS, Linux hosts only
+	ProxyPool         *ProxyPool              // Connect through the proxy of ProxyKey in the pool, moving to another one on the results the pool rotates on
+	ProxyKey          string                  // Key binding the persona to its proxy in ProxyPool, one per persona
 }
 
 func ImpersonateHeaders(h AnyHttpHeader, impersonateOption ImpersonateOption, isSecureContext bool) {
@@ -81,6 +137,11 @@ func ImpersonateHeaders(h AnyHttpHeader, impersonateOption ImpersonateOption, is
 	for k, v := range impersonateOption.OverwriteHeaders {
 		h.Set(k, v)
 	}
+	if impersonateOption.Browser.Type.IsNativeApp() {
+		impersonateAppHeaders(hSet, impersonateOption)
+		return
+	}
+	protected := overwriteProtectedHeader{headers: h, overwriteHeaders: impersonateOption.OverwriteHeaders}
 	// All browsers send the upgrade-insecure-requests header...
 	hSet("Upgrade-Insecure-Requests", "1")
 	if !isSecureContext {
@@ -88,31 +149,62 @@ func ImpersonateHeaders(h AnyHttpHeader, impersonateOption ImpersonateOption, is
 		hSet("Accept-Encoding", "gzip, deflate")
 	}
 
-	// Just a default accept-language, can be overwritten, and should be.
-	hSet("Accept-Language", "en-US,en;q=0.9")
-	switch impersonateOption.Browser.Type {
-	case BrowserSafari:
-		hSet("Priority", "u=0, i")
-		hSet("User-Agent", GetSafariUserAgent(impersonateOption.OS))
+	if impersonateOption.UsesWebKit() {
+		// WKWebView builds the Accept-Language, whatever the browser.
+		hSet("Accept-Language", GetAcceptLanguage(BrowserSafari, impersonateOption.GetLocales()))
+	} else {
+		hSet("Accept-Language", GetAcceptLanguage(impersonateOption.Browser.Type, impersonateOption.GetLocales()))
+	}
+	switch {
+	case impersonateOption.UsesWebKit() && impersonateOption.Browser.Type != BrowserChrome:
+		// Every iOS browser but Chrome goes through plain WKWebView, and sends Safari's headers.
+		if isSecureContext {
+			hSet("Priority", GetPriorityHeader(impersonateOption, DestinationDocument))
+		}
+		hSet("User-Agent", GetUserAgent(impersonateOption))
 		hSet("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 		if isSecureContext {
 			// Accept-Encoding is same on IOS and MacOS
 			hSet("Accept-Encoding", "gzip, deflate, br")
 		}
 		// Safari seems to not send the sec-fetch-user header.
-		HeaderSecFetch(h, false)
-	case BrowserFirefox:
-		hSet("Priority", "u=0, i")
-		hSet("te", "trailers")
-		hSet("User-Agent", GetFirefoxUserAgent(impersonateOption.OS, impersonateOption.Browser.Version))
-		HeaderSecFetch(h, true)
-	case BrowserChrome, BrowserBrave, BrowserEdge:
 		if isSecureContext {
-			hSet("Priority", "u=0, i")
+			HeaderSecFetch(protected, false)
+		}
+		if impersonateOption.Browser.Type.SendsGPC() {
+			hSet("Sec-Gpc", "1")
+		}
+	case impersonateOption.Browser.Type.IsGecko():
+		geckoVersion := GetGeckoVersion(impersonateOption.Browser)
+		if impersonateOption.Browser.Type == BrowserTorBrowser {
+			// resistFingerprinting spoofs the language whatever the locale.
+			hSet("Accept-Language", "en-US,en;q=0.5")
+		}
+		if geckoVersion < 128 {
+			hSet("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8")
+		} else {
+			hSet("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		}
+		if isSecureContext {
+			if geckoVersion < 126 {
+				hSet("Accept-Encoding", "gzip, deflate, br")
+			} else {
+				hSet("Accept-Encoding", "gzip, deflate, br, zstd")
+			}
+		}
+		hSet("Priority", GetPriorityHeader(impersonateOption, DestinationDocument))
+		hSet("User-Agent", GetUserAgent(impersonateOption))
+		if isSecureContext {
+			hSet("te", "trailers")
+			HeaderSecFetch(protected, true)
+		}
+	case impersonateOption.Browser.Type.IsChromium():
+		if isSecureContext {
+			hSet("Priority", GetPriorityHeader(impersonateOption, DestinationDocument))
 		}
 
 		if impersonateOption.Browser.Version == 0 {
-			impersonateOption.Browser.Version = 142
+			impersonateOption.Browser.Version = GetLatestVersion(impersonateOption.Browser.Type)
 		}
 
 		if impersonateOption.OS == IOS {
@@ -124,75 +216,216 @@ func ImpersonateHeaders(h AnyHttpHeader, impersonateOption ImpersonateOption, is
 			hSet("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
 			if isSecureContext {
 				hSet("Accept-Encoding", "gzip, deflate, br, zstd")
+				// Client hints are restricted to secure transports
+				HeaderChromeSecChUA(protected, impersonateOption)
 			}
-			HeaderChromeSecChUA(h, impersonateOption)
 		}
-		hSet("Cache-Control", "max-age=0")
+		// Typed navigations send no Cache-Control, reloads add max-age=0 in ImpersonateRequestHeaders
 		if isSecureContext {
-			HeaderSecFetch(h, true)
+			HeaderSecFetch(protected, true)
 		}
-		if impersonateOption.Browser.Type == BrowserBrave {
+		if impersonateOption.Browser.Type.SendsGPC() {
 			hSet("Sec-Gpc", "1")
 		}
-		userAgentHeader := ""
-		switch impersonateOption.OS {
-		case Android:
-			userAgentHeader = fmt.Sprintf("Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Mobile Safari/537.36", impersonateOption.Browser.Version)
-		case IOS:
-			userAgentHeader = "Mozilla/5.0 (iPhone; CPU iPhone OS 26_1_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/142.0.7444.46 Mobile/15E148 Safari/604.1"
-		case Windows:
-			userAgentHeader = fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36", impersonateOption.Browser.Version)
-		case MacOS:
-			userAgentHeader = fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36", impersonateOption.Browser.Version)
-		}
-		if impersonateOption.Browser.Type == BrowserEdge {
-			userAgentHeader = userAgentHeader + fmt.Sprintf(" Edg/%d.0.0.0", impersonateOption.Browser.Version)
+		if impersonateOption.WebView {
+			hSet("X-Requested-With", impersonateOption.WebViewPackage)
 		}
-		hSet("User-Agent", userAgentHeader)
+		hSet("User-Agent", GetUserAgent(impersonateOption))
 	}
 }
 
 func GetHeaderOrder(impersonateOption ImpersonateOption) []string {
-	switch impersonateOption.Browser.Type {
-	case BrowserFirefox:
-		return []string{"User-Agent", "accept", "accept-language", "accept-encoding", "upgrade-insecure-requests", "sec-fecth-dest", "sec-fetch-mode", "sec-fetch-site", "sec-fetch-user", "priority"}
-	case BrowserBrave, BrowserChrome, BrowserEdge:
-		fallthrough
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		return []string{"accept-encoding", "user-agent"}
+	case impersonateOption.Browser.Type == BrowserCFNetwork:
+		return []string{"accept", "user-agent", "accept-language", "accept-encoding"}
+	case impersonateOption.UsesWebKit():
+		// Every iOS browser, Chrome included, sends what WKWebView writes.
+		return getWebKitHeaderOrder(impersonateOption)
+	case impersonateOption.Browser.Type.IsGecko():
+		return []string{"user-agent", "accept", "accept-language", "accept-encoding", "content-type", "content-length", "origin", "referer", "cookie", "upgrade-insecure-requests", "sec-fetch-dest", "sec-fetch-mode", "sec-fetch-site", "sec-fetch-user", "priority", "te"}
 	default:
-		if impersonateOption.OS == IOS {
-			//return []string{}
+		return []string{"content-length", "cache-control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "sec-ch-ua-platform-version", "sec-ch-ua-full-version-list", "sec-ch-ua-model", "sec-ch-viewport-width", "sec-ch-dpr", "origin", "content-type", "sec-gpc", "upgrade-insecure-requests", "user-agent", "accept", "x-requested-with", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest", "referer", "accept-encoding", "accept-language", "cookie", "priority"}
+	}
+}
+
+// WebKit reordered its request headers in Safari 18 and iOS 18, Sec-Fetch-Dest and User-Agent moved up front.
+// The same order is used for navigations and subresources, only the headers present differ.
+func getWebKitHeaderOrder(impersonateOption ImpersonateOption) []string {
+	webKitVersion := 26
+	if numbers := parseOSVersion(GetSafariVersion(impersonateOption)); len(numbers) > 0 {
+		webKitVersion = numbers[0]
+	}
+	if webKitVersion >= 18 {
+		return []string{"sec-fetch-dest", "user-agent", "accept", "content-type", "origin", "sec-fetch-site", "sec-fetch-mode", "upgrade-insecure-requests", "referer", "cache-control", "sec-gpc", "accept-language", "priority", "accept-encoding", "cookie", "content-length"}
+	}
+	return []string{"content-type", "accept", "sec-fetch-site", "origin", "cookie", "sec-fetch-dest", "cache-control", "accept-language", "sec-fetch-mode", "upgrade-insecure-requests", "user-agent", "sec-gpc", "referer", "content-length", "priority", "accept-encoding"}
+}
+
+// GetHTTP1HeaderOrder returns the header order on HTTP/1.1 connections, with the casing browsers write the names with.
+// Host comes first, and Chromium keeps its client hints lowercase.
+func GetHTTP1HeaderOrder(impersonateOption ImpersonateOption) []string {
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		return []string{"Host", "Connection", "Accept-Encoding", "User-Agent"}
+	case impersonateOption.Browser.Type == BrowserCFNetwork:
+		return []string{"Host", "Accept", "User-Agent", "Accept-Language", "Accept-Encoding", "Connection"}
+	case impersonateOption.UsesWebKit():
+		// WebKit writes the same order as on HTTP/2, with Host first and Connection last
+		order := []string{"Host"}
+		for _, name := range getWebKitHeaderOrder(impersonateOption) {
+			order = append(order, textproto.CanonicalMIMEHeaderKey(name))
 		}
-		return []string{"cache-control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "sec-gpc", "upgrade-insecure-requests", "user-agent", "accept", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest", "accept-encoding", "accept-language"}
+		return append(order, "Connection")
+	case impersonateOption.Browser.Type.IsGecko():
+		return []string{"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Content-Type", "Content-Length", "Origin", "Connection", "Referer", "Cookie", "Upgrade-Insecure-Requests", "Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User", "Priority"}
+	default:
+		return []string{"Host", "Connection", "Content-Length", "Cache-Control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "sec-ch-ua-platform-version", "sec-ch-ua-full-version-list", "sec-ch-ua-model", "sec-ch-viewport-width", "sec-ch-dpr", "Origin", "Content-Type", "Sec-GPC", "Upgrade-Insecure-Requests", "User-Agent", "Accept", "X-Requested-With", "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-User", "Sec-Fetch-Dest", "Referer", "Accept-Encoding", "Accept-Language", "Cookie"}
 	}
 }
 
-func GetSafariUserAgent(os ImpersonateOS) string {
-	switch os {
+// GetUserAgent returns the User-Agent header of the persona.
+func GetUserAgent(impersonateOption ImpersonateOption) string {
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		return GetOkHttpUserAgent(impersonateOption)
+	case impersonateOption.Browser.Type == BrowserCFNetwork:
+		return GetCFNetworkUserAgent(impersonateOption)
+	case impersonateOption.Browser.Type == BrowserSafari:
+		return GetSafariUserAgent(impersonateOption)
+	case impersonateOption.Browser.Type == BrowserBrave && impersonateOption.OS == IOS:
+		// Brave on iOS does not add any token to Safari's User-Agent
+		return GetSafariUserAgent(impersonateOption)
+	case impersonateOption.Browser.Type.IsGecko():
+		return GetFirefoxUserAgent(impersonateOption)
+	case impersonateOption.Browser.Type == BrowserDuckDuckGo:
+		return GetDuckDuckGoUserAgent(impersonateOption)
+	case impersonateOption.WebView:
+		return GetAndroidWebViewUserAgent(impersonateOption)
+	default:
+		return GetChromiumUserAgent(impersonateOption)
+	}
+}
+
+func GetChromiumUserAgent(impersonateOption ImpersonateOption) string {
+	version := impersonateOption.Browser.Version
+	if version == 0 {
+		version = GetLatestVersion(impersonateOption.Browser.Type)
+	}
+	platform := ""
+	switch impersonateOption.OS {
+	case Android:
+		// Reduced User-Agent, the real Android version and model are only in the client hints.
+		platform = "Linux; Android 10; K"
+	case IOS:
+		if impersonateOption.Browser.Type == BrowserEdge {
+			return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s EdgiOS/%s Mobile/15E148 Safari/605.1.15",
+				getIOSPlatformToken(impersonateOption, getIOSUserAgentVersion(impersonateOption.GetOSVersion())),
+				GetSafariVersion(impersonateOption),
+				GetEdgeFullVersion(version),
+			)
+		}
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/%s Mobile/15E148 Safari/604.1", getIOSPlatformToken(impersonateOption, getIOSUserAgentVersion(impersonateOption.GetOSVersion())), GetChromeFullVersion(version))
+	case Windows:
+		// Windows 11 still reports NT 10.0
+		platform = "Windows NT 10.0; Win64; x64"
 	case MacOS:
-		return "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0.1 Safari/605.1.15"
+		// macOS version is frozen to 10_15_7
+		platform = "Macintosh; Intel Mac OS X 10_15_7"
+	case Linux:
+		platform = "X11; Linux x86_64"
+	}
+	mobileToken := ""
+	if impersonateOption.IsMobile() {
+		mobileToken = "Mobile "
+	}
+	vendorPrefix, vendorToken, vendorSuffix := "", "", ""
+	switch impersonateOption.Browser.Type {
+	case BrowserSamsung:
+		vendorPrefix = "SamsungBrowser/" + GetSamsungInternetVersion(version) + " "
+	case BrowserYandex:
+		vendorToken = "YaBrowser/" + GetYandexVersion(version) + ".0.0 "
+	case BrowserEdge:
+		if impersonateOption.OS == Android {
+			vendorSuffix = fmt.Sprintf(" EdgA/%d.0.0.0", version)
+		} else {
+			vendorSuffix = fmt.Sprintf(" Edg/%d.0.0.0", version)
+		}
+	}
+	// Vivaldi and Brave use the exact Chrome User-Agent.
+	return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) %sChrome/%d.0.0.0 %s%sSafari/537.36%s", platform, vendorPrefix, version, vendorToken, mobileToken, vendorSuffix)
+}
+
+// GetDuckDuckGoUserAgent returns the User-Agent of the DuckDuckGo mobile browser,
+// a System WebView on Android and a WKWebView on iOS.
+func GetDuckDuckGoUserAgent(impersonateOption ImpersonateOption) string {
+	if impersonateOption.OS == IOS {
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s Mobile/15E148 DuckDuckGo/7 Safari/604.1",
+			getIOSPlatformToken(impersonateOption, getIOSUserAgentVersion(impersonateOption.GetOSVersion())),
+			formatOSVersion(impersonateOption.GetOSVersion(), 2, "."),
+		)
+	}
+	version := impersonateOption.Browser.Version
+	if version == 0 {
+		version = GetLatestVersion(BrowserDuckDuckGo)
+	}
+	mobileToken := "Mobile "
+	if impersonateOption.IsTablet() {
+		mobileToken = ""
+	}
+	return fmt.Sprintf("Mozilla/5.0 (Linux; Android %s) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/%d.0.0.0 %sDuckDuckGo/5 Safari/537.36",
+		formatOSVersion(impersonateOption.GetOSVersion(), 1, "."),
+		version,
+		mobileToken,
+	)
+}
+
+// Platform part of the User-Agent of third party iOS browsers, which keep the mobile User-Agent on iPad.
+func getIOSPlatformToken(impersonateOption ImpersonateOption, version string) string {
+	if impersonateOption.IsTablet() {
+		return fmt.Sprintf("iPad; CPU OS %s like Mac OS X", version)
+	}
+	return fmt.Sprintf("iPhone; CPU iPhone OS %s like Mac OS X", version)
+}
+
+func GetSafariUserAgent(impersonateOption ImpersonateOption) string {
+	safariVersion := GetSafariVersion(impersonateOption)
+	switch impersonateOption.OS {
 	case IOS:
-		// Firefox on iOS uses WebKit engine, not Gecko
-		return "Mozilla/5.0 (iPhone; CPU iPhone OS 18_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.1 Mobile/15E148 Safari/604.1"
+		if impersonateOption.IsTablet() {
+			// iPad Safari requests desktop websites by default, and presents itself as macOS Safari.
+			return fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s Safari/605.1.15", safariVersion)
+		}
+		return fmt.Sprintf("Mozilla/5.0 (iPhone; CPU iPhone OS %s like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s Mobile/15E148 Safari/604.1", getIOSUserAgentVersion(impersonateOption.GetOSVersion()), safariVersion)
 	default:
-		return "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0.1 Safari/605.1.15"
+		// macOS version is frozen to 10_15_7
+		return fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s Safari/605.1.15", safariVersion)
 	}
 }
-func GetFirefoxUserAgent(os ImpersonateOS, version int) string {
-	if version == 0 {
-		version = 145
+func GetFirefoxUserAgent(impersonateOption ImpersonateOption) string {
+	version := GetGeckoVersion(impersonateOption.Browser)
+	if impersonateOption.Browser.Type == BrowserTorBrowser {
+		// Tor Browser reports Windows whatever the OS.
+		return fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:%d.0) Gecko/20100101 Firefox/%d.0", version, version)
 	}
-	switch os {
+	switch impersonateOption.OS {
 	case Windows:
 		return fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:%d.0) Gecko/20100101 Firefox/%d.0", version, version)
 	case MacOS:
+		// Firefox caps the reported macOS version to 10.15
 		return fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:%d.0) Gecko/20100101 Firefox/%d.0", version, version)
 	case Linux:
 		return fmt.Sprintf("Mozilla/5.0 (X11; Linux x86_64; rv:%d.0) Gecko/20100101 Firefox/%d.0", version, version)
 	case Android:
-		return fmt.Sprintf("Mozilla/5.0 (Android 13; Mobile; rv:%d.0) Gecko/%d.0 Firefox/%d.0", version, version, version)
+		formFactor := "Mobile"
+		if impersonateOption.IsTablet() {
+			formFactor = "Tablet"
+		}
+		return fmt.Sprintf("Mozilla/5.0 (Android %s; %s; rv:%d.0) Gecko/%d.0 Firefox/%d.0", formatOSVersion(impersonateOption.GetOSVersion(), 1, "."), formFactor, version, version, version)
 	case IOS:
 		// Firefox on iOS uses WebKit engine, not Gecko
-		return fmt.Sprintf("Mozilla/5.0 (iPhone; CPU iPhone OS 26_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/%d.0  Mobile/15E148 Safari/604.1", version)
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/%d.0 Mobile/15E148 Safari/604.1", getIOSPlatformToken(impersonateOption, getIOSUserAgentVersion(impersonateOption.GetOSVersion())), version)
 	default:
 		return fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:%d.0) Gecko/20100101 Firefox/%d.0", version, version)
 	}
@@ -215,19 +448,32 @@ func GetRandomRealisticImpersonateOption() ImpersonateOption {
 	var browserTypeOptions []BrowserType
 	switch pickedOS {
 	case IOS:
-		browserTypeOptions = []BrowserType{BrowserSafari, BrowserChrome}
+		browserTypeOptions = []BrowserType{BrowserSafari, BrowserChrome, BrowserDuckDuckGo, BrowserEdge, BrowserBrave, BrowserFirefox}
 	case MacOS:
-		browserTypeOptions = []BrowserType{BrowserSafari, BrowserBrave, BrowserChrome, BrowserFirefox}
+		browserTypeOptions = []BrowserType{BrowserSafari, BrowserBrave, BrowserChrome, BrowserFirefox, BrowserVivaldi}
 	case Windows:
-		browserTypeOptions = []BrowserType{BrowserEdge, BrowserBrave, BrowserChrome, BrowserFirefox}
+		browserTypeOptions = []BrowserType{BrowserEdge, BrowserBrave, BrowserChrome, BrowserFirefox, BrowserVivaldi, BrowserYandex}
 	case Android:
-		browserTypeOptions = []BrowserType{BrowserChrome}
+		browserTypeOptions = []BrowserType{BrowserChrome, BrowserSamsung, BrowserDuckDuckGo, BrowserEdge, BrowserBrave, BrowserFirefox}
 	}
 	browserTypePicked := browserTypeOptions[rand.Intn(len(browserTypeOptions))]
-	return ImpersonateOption{
+	option := ImpersonateOption{
 		OS: pickedOS,
 		Browser: ImpersonateBrowser{
 			Type: browserTypePicked,
 		},
 	}
+	// Roughly one in five mobile personas is a tablet.
+	isTablet := rand.Intn(5) == 0
+	switch {
+	case pickedOS == Android && isTablet:
+		option.Device = AndroidTablets[rand.Intn(len(AndroidTablets))]
+	case pickedOS == Android && browserTypePicked == BrowserSamsung:
+		option.Device = GetRandomSamsungDevice()
+	case pickedOS == Android:
+		option.Device = GetRandomAndroidDevice()
+	case pickedOS == IOS && isTablet:
+		option.Device = IPadDevices[rand.Intn(len(IPadDevices))]
+	}
+	return option
 }
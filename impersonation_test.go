@@ -0,0 +1,359 @@
+package browser_impersonate
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestImpersonateHeadersUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   string
+	}{
+		{
+			name:   "chrome on windows",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
+		},
+		{
+			name:   "chrome on linux",
+			option: ImpersonateOption{OS: Linux, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 141}},
+			want:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36",
+		},
+		{
+			name:   "edge on macos",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserEdge, Version: 140}},
+			want:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36 Edg/140.0.0.0",
+		},
+		{
+			name:   "chrome on android",
+			option: ImpersonateOption{OS: Android, OSVersion: "14", Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Mobile Safari/537.36",
+		},
+		{
+			name:   "chrome on ios 17",
+			option: ImpersonateOption{OS: IOS, OSVersion: "17.5", Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/142.0.7444.46 Mobile/15E148 Safari/604.1",
+		},
+		{
+			name:   "safari on macos",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 18}},
+			want:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+		},
+		{
+			name:   "safari 17 on ios",
+			option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}},
+			want:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.7 Mobile/15E148 Safari/604.1",
+		},
+		{
+			name:   "latest safari on ios",
+			option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari}},
+			want:   "Mozilla/5.0 (iPhone; CPU iPhone OS 18_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.1 Mobile/15E148 Safari/604.1",
+		},
+		{
+			name:   "firefox on macos",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserFirefox}},
+			want:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:145.0) Gecko/20100101 Firefox/145.0",
+		},
+		{
+			name:   "firefox on android",
+			option: ImpersonateOption{OS: Android, OSVersion: "14", Browser: ImpersonateBrowser{Type: BrowserFirefox, Version: 140}},
+			want:   "Mozilla/5.0 (Android 14; Mobile; rv:140.0) Gecko/140.0 Firefox/140.0",
+		},
+		{
+			name:   "firefox on ios",
+			option: ImpersonateOption{OS: IOS, OSVersion: "18.6", Browser: ImpersonateBrowser{Type: BrowserFirefox}},
+			want:   "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/145.0 Mobile/15E148 Safari/604.1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			if got := h.Get("User-Agent"); got != test.want {
+				t.Errorf("User-Agent = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestImpersonateHeadersClientHints(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name:   "chrome on windows 11",
+			option: ImpersonateOption{OS: Windows, OSVersion: "11", Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}},
+			want: map[string]string{
+				"Sec-Ch-Ua":                   `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`,
+				"Sec-Ch-Ua-Mobile":            "?0",
+				"Sec-Ch-Ua-Platform":          `"Windows"`,
+				"Sec-Ch-Ua-Platform-Version":  "",
+				"Sec-Ch-Ua-Full-Version-List": "",
+			},
+		},
+		{
+			name:   "chrome on windows 11 with high entropy hints",
+			option: ImpersonateOption{OS: Windows, OSVersion: "11", Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 142}, HighEntropyHints: true},
+			want: map[string]string{
+				"Sec-Ch-Ua-Platform-Version":  `"19.0.0"`,
+				"Sec-Ch-Ua-Full-Version-List": `"Chromium";v="142.0.7444.46", "Google Chrome";v="142.0.7444.46", "Not_A Brand";v="99.0.0.0"`,
+			},
+		},
+		{
+			name:   "edge on android with high entropy hints",
+			option: ImpersonateOption{OS: Android, OSVersion: "14", Browser: ImpersonateBrowser{Type: BrowserEdge, Version: 142}, HighEntropyHints: true},
+			want: map[string]string{
+				"Sec-Ch-Ua-Mobile":            "?1",
+				"Sec-Ch-Ua-Platform":          `"Android"`,
+				"Sec-Ch-Ua-Platform-Version":  `"14.0.0"`,
+				"Sec-Ch-Ua-Full-Version-List": `"Chromium";v="142.0.7444.46", "Microsoft Edge";v="142.0.7444.46", "Not_A Brand";v="99.0.0.0"`,
+			},
+		},
+		{
+			name:   "firefox",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}, HighEntropyHints: true},
+			want: map[string]string{
+				"Sec-Ch-Ua":                  "",
+				"Sec-Ch-Ua-Platform-Version": "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImpersonateHeadersVendors(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name:   "samsung internet",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserSamsung, Version: 136}, Device: AndroidDevices[2]},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/29.0 Chrome/136.0.0.0 Mobile Safari/537.36",
+				"Sec-Ch-Ua":  `"Chromium";v="136", "Samsung Internet";v="29.0", "Not_A Brand";v="99"`,
+				"Sec-Gpc":    "",
+			},
+		},
+		{
+			name:   "yandex on windows",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserYandex, Version: 140}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 YaBrowser/25.10.0.0 Safari/537.36",
+			},
+		},
+		{
+			name:   "vivaldi on macos",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserVivaldi}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
+				"Sec-Ch-Ua":  `"Chromium";v="142", "Not_A Brand";v="99"`,
+			},
+		},
+		{
+			name:   "brave on windows",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserBrave, Version: 142}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
+				"Sec-Ch-Ua":  `"Chromium";v="142", "Brave";v="142", "Not_A Brand";v="99"`,
+				"Sec-Gpc":    "1",
+			},
+		},
+		{
+			name:   "duckduckgo on android",
+			option: ImpersonateOption{OS: Android, OSVersion: "14", Browser: ImpersonateBrowser{Type: BrowserDuckDuckGo}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/142.0.0.0 Mobile DuckDuckGo/5 Safari/537.36",
+				"Sec-Ch-Ua":  `"Chromium";v="142", "Android WebView";v="142", "Not_A Brand";v="99"`,
+				"Sec-Gpc":    "1",
+			},
+		},
+		{
+			name:   "duckduckgo on ios",
+			option: ImpersonateOption{OS: IOS, OSVersion: "18.6", Browser: ImpersonateBrowser{Type: BrowserDuckDuckGo}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.6 Mobile/15E148 DuckDuckGo/7 Safari/604.1",
+				"Sec-Ch-Ua":  "",
+				"Sec-Gpc":    "1",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImpersonateHeadersMobileVariants(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name:   "edge on ios",
+			option: ImpersonateOption{OS: IOS, OSVersion: "18.6", Browser: ImpersonateBrowser{Type: BrowserEdge, Version: 142}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.6 EdgiOS/142.0.3595.66 Mobile/15E148 Safari/605.1.15",
+				"Sec-Ch-Ua":  "",
+			},
+		},
+		{
+			name:   "edge on android",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserEdge, Version: 142}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Mobile Safari/537.36 EdgA/142.0.0.0",
+				"Sec-Ch-Ua":  `"Chromium";v="142", "Microsoft Edge";v="142", "Not_A Brand";v="99"`,
+			},
+		},
+		{
+			name:   "brave on ios",
+			option: ImpersonateOption{OS: IOS, OSVersion: "18.6", Browser: ImpersonateBrowser{Type: BrowserBrave}},
+			want: map[string]string{
+				"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.6 Mobile/15E148 Safari/604.1",
+				"Sec-Gpc":    "1",
+				"Sec-Ch-Ua":  "",
+			},
+		},
+		{
+			name:   "firefox on ios",
+			option: ImpersonateOption{OS: IOS, OSVersion: "18.6", Browser: ImpersonateBrowser{Type: BrowserFirefox}, Country: "DE"},
+			want: map[string]string{
+				"User-Agent":      "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/145.0 Mobile/15E148 Safari/604.1",
+				"Accept-Language": "de-DE,de;q=0.9",
+				"Te":              "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImpersonateHeadersGecko(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string
+	}{
+		{
+			name:   "firefox",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}},
+			want: map[string]string{
+				"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+				"Accept-Encoding": "gzip, deflate, br, zstd",
+				"Te":              "trailers",
+			},
+		},
+		{
+			name:   "firefox esr 115",
+			option: ImpersonateOption{OS: Linux, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 115}},
+			want: map[string]string{
+				"User-Agent":      "Mozilla/5.0 (X11; Linux x86_64; rv:115.0) Gecko/20100101 Firefox/115.0",
+				"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+				"Accept-Encoding": "gzip, deflate, br",
+			},
+		},
+		{
+			name:   "tor browser on linux",
+			option: ImpersonateOption{OS: Linux, Browser: ImpersonateBrowser{Type: BrowserTorBrowser, Version: 14}},
+			want: map[string]string{
+				"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0",
+				"Accept-Language": "en-US,en;q=0.5",
+				"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+				"Accept-Encoding": "gzip, deflate, br, zstd",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateHeaders(h, test.option, true)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetHeaderOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   []string
+	}{
+		{
+			name:   "chrome",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want:   []string{"content-length", "cache-control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "sec-ch-ua-platform-version", "sec-ch-ua-full-version-list", "sec-ch-ua-model", "sec-ch-viewport-width", "sec-ch-dpr", "origin", "content-type", "sec-gpc", "upgrade-insecure-requests", "user-agent", "accept", "x-requested-with", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest", "referer", "accept-encoding", "accept-language", "cookie", "priority"},
+		},
+		{
+			name:   "okhttp",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}},
+			want:   []string{"accept-encoding", "user-agent"},
+		},
+		{
+			name:   "cfnetwork",
+			option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserCFNetwork}},
+			want:   []string{"accept", "user-agent", "accept-language", "accept-encoding"},
+		},
+		{
+			name:   "safari 26",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 26}},
+			want:   []string{"sec-fetch-dest", "user-agent", "accept", "content-type", "origin", "sec-fetch-site", "sec-fetch-mode", "upgrade-insecure-requests", "referer", "cache-control", "sec-gpc", "accept-language", "priority", "accept-encoding", "cookie", "content-length"},
+		},
+		{
+			name:   "safari 17",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}},
+			want:   []string{"content-type", "accept", "sec-fetch-site", "origin", "cookie", "sec-fetch-dest", "cache-control", "accept-language", "sec-fetch-mode", "upgrade-insecure-requests", "user-agent", "sec-gpc", "referer", "content-length", "priority", "accept-encoding"},
+		},
+		{
+			name:   "chrome on ios 17",
+			option: ImpersonateOption{OS: IOS, OSVersion: "17.5", Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want:   []string{"content-type", "accept", "sec-fetch-site", "origin", "cookie", "sec-fetch-dest", "cache-control", "accept-language", "sec-fetch-mode", "upgrade-insecure-requests", "user-agent", "sec-gpc", "referer", "content-length", "priority", "accept-encoding"},
+		},
+		{
+			name:   "tor browser",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserTorBrowser}},
+			want:   []string{"user-agent", "accept", "accept-language", "accept-encoding", "content-type", "content-length", "origin", "referer", "cookie", "upgrade-insecure-requests", "sec-fetch-dest", "sec-fetch-mode", "sec-fetch-site", "sec-fetch-user", "priority", "te"},
+		},
+	}
+	for _, test := range tests {
+		if got := GetHeaderOrder(test.option); !slices.Equal(got, test.want) {
+			t.Errorf("%s: GetHeaderOrder() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
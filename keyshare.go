@@ -0,0 +1,57 @@
+package browser_impersonate
+
+// Hybrid post-quantum key exchange groups.
+const (
+	CurveX25519MLKEM768           uint16 = 4588
+	CurveX25519Kyber768Draft00    uint16 = 0x6399
+	CurveX25519Kyber768Draft00Old uint16 = 0xfe31 // Chrome 115 to 123 behind a flag
+)
+
+// IsPostQuantumGroup reports whether the group is one of the hybrid post-quantum groups browsers shipped.
+func IsPostQuantumGroup(group uint16) bool {
+	switch group {
+	case CurveX25519MLKEM768, CurveX25519Kyber768Draft00, CurveX25519Kyber768Draft00Old:
+		return true
+	}
+	return false
+}
+
+// GetPostQuantumGroup returns the hybrid post-quantum group the browser puts first in supported_groups and
+// sends a key share for, 0 when it has none.
+// Only one is offered, next to an X25519 share: a server without post-quantum support picks X25519,
+// and one supporting none of the shares sends a HelloRetryRequest for another supported group.
+func GetPostQuantumGroup(impersonateOption ImpersonateOption) uint16 {
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		// Conscrypt has no post-quantum group
+		return 0
+	case impersonateOption.Browser.Type == BrowserCFNetwork || impersonateOption.UsesWebKit():
+		// Added along with the rest of the OS in 26
+		version := impersonateOption.GetOSVersion()
+		if impersonateOption.UsesWebKit() {
+			version = GetSafariVersion(impersonateOption)
+		}
+		if numbers := parseOSVersion(version); len(numbers) > 0 && numbers[0] >= 26 {
+			return CurveX25519MLKEM768
+		}
+		return 0
+	case impersonateOption.Browser.Type.IsGecko():
+		if GetGeckoVersion(impersonateOption.Browser) >= 132 {
+			return CurveX25519MLKEM768
+		}
+		return 0
+	default:
+		version := impersonateOption.Browser.Version
+		if version == 0 {
+			version = GetLatestVersion(impersonateOption.Browser.Type)
+		}
+		switch {
+		case version >= 131:
+			return CurveX25519MLKEM768
+		case version >= 124:
+			return CurveX25519Kyber768Draft00
+		default:
+			return 0
+		}
+	}
+}
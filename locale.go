@@ -0,0 +1,148 @@
+package browser_impersonate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Default language preferences of a browser installed in a given country (ISO 3166-1 alpha-2).
+// Non English locales keep English as a fallback, as most installs end up that way.
+var CountryDefaultLocales = map[string][]string{
+	"US": {"en-US"},
+	"GB": {"en-GB"},
+	"CA": {"en-CA", "fr-CA"},
+	"AU": {"en-AU"},
+	"IE": {"en-IE"},
+	"NZ": {"en-NZ"},
+	"IN": {"en-IN", "hi-IN"},
+	"DE": {"de-DE", "en-US"},
+	"AT": {"de-AT", "en-US"},
+	"CH": {"de-CH", "fr-CH", "en-US"},
+	"FR": {"fr-FR", "en-US"},
+	"BE": {"fr-BE", "nl-BE", "en-US"},
+	"NL": {"nl-NL", "en-US"},
+	"ES": {"es-ES", "en-US"},
+	"MX": {"es-MX", "en-US"},
+	"AR": {"es-AR", "en-US"},
+	"IT": {"it-IT", "en-US"},
+	"PT": {"pt-PT", "en-US"},
+	"BR": {"pt-BR", "en-US"},
+	"PL": {"pl-PL", "en-US"},
+	"SE": {"sv-SE", "en-US"},
+	"NO": {"nb-NO", "en-US"},
+	"DK": {"da-DK", "en-US"},
+	"FI": {"fi-FI", "en-US"},
+	"RU": {"ru-RU", "en-US"},
+	"UA": {"uk-UA", "ru-RU", "en-US"},
+	"TR": {"tr-TR", "en-US"},
+	"JP": {"ja-JP", "en-US"},
+	"KR": {"ko-KR", "en-US"},
+	"CN": {"zh-CN", "en-US"},
+	"TW": {"zh-TW", "en-US"},
+}
+
+// GetLocales returns the preferred languages of the persona, from Locales, then Country, falling back to en-US.
+func (o ImpersonateOption) GetLocales() []string {
+	if len(o.Locales) > 0 {
+		return o.Locales
+	}
+	if locales, ok := CountryDefaultLocales[strings.ToUpper(o.Country)]; ok {
+		return locales
+	}
+	return []string{"en-US"}
+}
+
+// NormalizeLanguageTag canonicalizes the casing of a BCP 47 tag, "en_us" becomes "en-US" and "zh-hant-tw" becomes "zh-Hant-TW".
+func NormalizeLanguageTag(tag string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Adds the base language right after the last regional variant of it, the way Chrome and Firefox language settings do.
+// en-US,de-DE becomes en-US,en,de-DE,de
+func expandBaseLanguages(locales []string) []string {
+	expanded := []string{}
+	seen := map[string]bool{}
+	add := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			expanded = append(expanded, tag)
+		}
+	}
+	for i, locale := range locales {
+		tag := NormalizeLanguageTag(locale)
+		if tag == "" {
+			continue
+		}
+		add(tag)
+		base := strings.Split(tag, "-")[0]
+		nextHasSameBase := i+1 < len(locales) && strings.Split(NormalizeLanguageTag(locales[i+1]), "-")[0] == base
+		if !nextHasSameBase {
+			add(base)
+		}
+	}
+	return expanded
+}
+
+// GetAcceptLanguage builds the Accept-Language value the given browser sends for the list of preferred languages.
+func GetAcceptLanguage(browserType BrowserType, locales []string) string {
+	locales = slices.DeleteFunc(slices.Clone(locales), func(locale string) bool {
+		return NormalizeLanguageTag(locale) == ""
+	})
+	if len(locales) == 0 {
+		locales = []string{"en-US"}
+	}
+	switch browserType {
+	case BrowserSafari:
+		// Safari only advertises the primary language of the system.
+		return strings.Join(withQValues(expandBaseLanguages(locales[:1]), chromiumQValue), ",")
+	case BrowserFirefox, BrowserFirefoxESR, BrowserTorBrowser:
+		return strings.Join(withQValues(expandBaseLanguages(locales), firefoxQValue), ",")
+	default:
+		return strings.Join(withQValues(expandBaseLanguages(locales), chromiumQValue), ",")
+	}
+}
+
+func withQValues(tags []string, qValue func(index int, count int) string) []string {
+	values := make([]string, len(tags))
+	for i, tag := range tags {
+		if i == 0 {
+			values[i] = tag
+			continue
+		}
+		values[i] = tag + ";q=" + qValue(i, len(tags))
+	}
+	return values
+}
+
+// Chromium decrements by 0.1 per language, and stays at 0.1 once reached.
+func chromiumQValue(index int, _ int) string {
+	q := 10 - index
+	if q < 1 {
+		q = 1
+	}
+	return fmt.Sprintf("0.%d", q)
+}
+
+// Firefox spreads the q-values evenly over the list, rounding to one decimal (two past 10 languages).
+func firefoxQValue(index int, count int) string {
+	if count < 10 {
+		q := (10*(count-index) + count/2) / count
+		return fmt.Sprintf("0.%d", q)
+	}
+	q := (100*(count-index) + count/2) / count
+	return fmt.Sprintf("0.%02d", q)
+}
@@ -0,0 +1,93 @@
+package browser_impersonate
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeLanguageTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "en-US", want: "en-US"},
+		{tag: "en_us", want: "en-US"},
+		{tag: " EN ", want: "en"},
+		{tag: "zh-hant-tw", want: "zh-Hant-TW"},
+		{tag: "es-419", want: "es-419"},
+		{tag: "", want: ""},
+		{tag: "  ", want: ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeLanguageTag(test.tag); got != test.want {
+			t.Errorf("NormalizeLanguageTag(%q) = %q, want %q", test.tag, got, test.want)
+		}
+	}
+}
+
+func TestGetAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		browser BrowserType
+		locales []string
+		want    string
+	}{
+		{browser: BrowserChrome, locales: []string{"en-US"}, want: "en-US,en;q=0.9"},
+		{browser: BrowserChrome, locales: []string{"de-DE", "en-US"}, want: "de-DE,de;q=0.9,en-US;q=0.8,en;q=0.7"},
+		{browser: BrowserChrome, locales: []string{"en-US", "en-GB"}, want: "en-US,en-GB;q=0.9,en;q=0.8"},
+		{browser: BrowserEdge, locales: []string{"en_gb"}, want: "en-GB,en;q=0.9"},
+		{browser: BrowserChrome, locales: []string{"", " "}, want: "en-US,en;q=0.9"},
+		{browser: BrowserChrome, locales: nil, want: "en-US,en;q=0.9"},
+		{browser: BrowserFirefox, locales: []string{"en-US"}, want: "en-US,en;q=0.5"},
+		{browser: BrowserFirefox, locales: []string{"de-DE", "en-US"}, want: "de-DE,de;q=0.8,en-US;q=0.5,en;q=0.3"},
+		{browser: BrowserFirefoxESR, locales: []string{"en-US"}, want: "en-US,en;q=0.5"},
+		{browser: BrowserSafari, locales: []string{"fr-FR", "en-US"}, want: "fr-FR,fr;q=0.9"},
+	}
+	for _, test := range tests {
+		if got := GetAcceptLanguage(test.browser, test.locales); got != test.want {
+			t.Errorf("GetAcceptLanguage(%s, %q) = %q, want %q", test.browser, test.locales, got, test.want)
+		}
+	}
+}
+
+func TestGetLocales(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   []string
+	}{
+		{name: "locales", option: ImpersonateOption{Locales: []string{"pt-BR"}, Country: "DE"}, want: []string{"pt-BR"}},
+		{name: "country", option: ImpersonateOption{Country: "de"}, want: []string{"de-DE", "en-US"}},
+		{name: "unknown country", option: ImpersonateOption{Country: "ZZ"}, want: []string{"en-US"}},
+		{name: "nothing", option: ImpersonateOption{}, want: []string{"en-US"}},
+	}
+	for _, test := range tests {
+		if got := test.option.GetLocales(); !slices.Equal(got, test.want) {
+			t.Errorf("%s: GetLocales() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestImpersonateHeadersAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   string
+	}{
+		{name: "chrome in France", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, Country: "FR"}, want: "fr-FR,fr;q=0.9,en-US;q=0.8,en;q=0.7"},
+		{name: "firefox in Japan", option: ImpersonateOption{OS: Linux, Browser: ImpersonateBrowser{Type: BrowserFirefox}, Country: "JP"}, want: "ja-JP,ja;q=0.8,en-US;q=0.5,en;q=0.3"},
+		{name: "safari in Canada", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}, Country: "CA"}, want: "en-CA,en;q=0.9"},
+		{
+			name:   "overwritten",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, Country: "FR", OverwriteHeaders: map[string]string{"accept-language": "it"}},
+			want:   "it",
+		},
+	}
+	for _, test := range tests {
+		h := http.Header{}
+		ImpersonateHeaders(h, test.option, true)
+		if got := h.Get("Accept-Language"); got != test.want {
+			t.Errorf("%s: Accept-Language = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
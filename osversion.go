@@ -0,0 +1,234 @@
+package browser_impersonate
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Default OSVersion per OS, when not set on the ImpersonateOption.
+var DefaultOSVersions = map[ImpersonateOS]string{
+	Windows: "10",
+	MacOS:   "26.0.1",
+	IOS:     "26.1",
+	Android: "15",
+	Linux:   "",
+}
+
+// Safari and Chrome froze the iOS version reported in the User-Agent to 18.x starting with iOS 26.
+const frozenIOSUserAgentVersion = "18_7"
+
+// Stable full Chrome versions, CriOS and Sec-Ch-Ua-Full-Version-List carry the full build.
+var chromeFullVersions = map[int]string{
+	120: "120.0.6099.109",
+	121: "121.0.6167.85",
+	122: "122.0.6261.94",
+	123: "123.0.6312.58",
+	124: "124.0.6367.60",
+	125: "125.0.6422.60",
+	126: "126.0.6478.55",
+	127: "127.0.6533.72",
+	128: "128.0.6613.84",
+	129: "129.0.6668.58",
+	130: "130.0.6723.58",
+	131: "131.0.6778.85",
+	132: "132.0.6834.83",
+	133: "133.0.6943.53",
+	134: "134.0.6998.88",
+	135: "135.0.7049.84",
+	136: "136.0.7103.48",
+	137: "137.0.7151.55",
+	138: "138.0.7204.96",
+	139: "139.0.7258.66",
+	140: "140.0.7339.80",
+	141: "141.0.7390.54",
+	142: "142.0.7444.46",
+}
+
+// Latest iOS release of each Safari version, Safari on iOS ships with the OS.
+var iOSSafariReleases = map[int]string{
+	15: "15.8",
+	16: "16.7",
+	17: "17.7",
+	18: "18.7",
+	26: "26.1",
+}
+
+// GetOSVersion returns OSVersion, or the default version of the OS when unset.
+// Safari on iOS without OSVersion gets the iOS release of its version.
+func (o ImpersonateOption) GetOSVersion() string {
+	if o.OSVersion != "" {
+		return o.OSVersion
+	}
+	if release, ok := iOSSafariReleases[o.Browser.Version]; ok && o.OS == IOS && o.Browser.Type == BrowserSafari {
+		return release
+	}
+	if o.Device.OSVersion != "" {
+		return o.Device.OSVersion
+	}
+	return DefaultOSVersions[o.OS]
+}
+
+// Parses "18.7.1" into [18, 7, 1], returns nil if any part is not a number.
+func parseOSVersion(version string) []int {
+	if version == "" {
+		return nil
+	}
+	parts := strings.Split(version, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil
+		}
+		numbers[i] = n
+	}
+	return numbers
+}
+
+// Pads or truncates the version to the given number of components, "26.1" with 3 becomes "26.1.0".
+func formatOSVersion(version string, components int, separator string) string {
+	numbers := parseOSVersion(version)
+	parts := make([]string, components)
+	for i := range parts {
+		n := 0
+		if i < len(numbers) {
+			n = numbers[i]
+		}
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, separator)
+}
+
+// Returns the "18_7" like token used in the iOS User-Agent, as WebKit reports it.
+func getIOSUserAgentVersion(version string) string {
+	numbers := parseOSVersion(version)
+	if len(numbers) > 0 && numbers[0] >= 26 {
+		return frozenIOSUserAgentVersion
+	}
+	if len(numbers) > 2 && numbers[2] != 0 {
+		return formatOSVersion(version, 3, "_")
+	}
+	return formatOSVersion(version, 2, "_")
+}
+
+// GetChromeFullVersion returns the full build version of a Chrome major version, e.g. 142.0.7444.46
+func GetChromeFullVersion(major int) string {
+	if full, ok := chromeFullVersions[major]; ok {
+		return full
+	}
+	// Roughly 60 builds per major version.
+	return fmt.Sprintf("%d.0.%d.0", major, 7444+(major-142)*60)
+}
+
+// GetEdgeFullVersion returns the full Edge build of a Chromium major version, EdgiOS carries it.
+// Edge builds are numbered on their own, 142 is 142.0.3595.x
+func GetEdgeFullVersion(major int) string {
+	return fmt.Sprintf("%d.0.%d.66", major, 3595+(major-142)*55)
+}
+
+// Samsung Internet major version and the Chromium major version it first shipped with.
+var samsungInternetVersions = []struct {
+	chromium int
+	samsung  string
+}{
+	{122, "25.0"},
+	{125, "26.0"},
+	{128, "27.0"},
+	{130, "28.0"},
+	{136, "29.0"},
+}
+
+// GetSamsungInternetVersion returns the SamsungBrowser/ version built on the given Chromium major version.
+func GetSamsungInternetVersion(chromiumVersion int) string {
+	samsung := samsungInternetVersions[0].samsung
+	for _, v := range samsungInternetVersions {
+		if chromiumVersion >= v.chromium {
+			samsung = v.samsung
+		}
+	}
+	return samsung
+}
+
+// GetYandexVersion returns the YaBrowser/ year.month version built on the given Chromium major version,
+// Yandex releases monthly following Chromium, 140 shipped as 25.10
+func GetYandexVersion(chromiumVersion int) string {
+	months := 25*12 + 9 + (chromiumVersion - 140)
+	return fmt.Sprintf("%d.%d", months/12, months%12+1)
+}
+
+// Tor Browser major version and the Firefox ESR it is built on.
+var torBrowserESRVersions = map[int]int{
+	13: 115,
+	14: 128,
+	15: 140,
+}
+
+// FirefoxESRVersions are the ESR branches, ImpersonateBrowser.Version of BrowserFirefoxESR must be one of them.
+var FirefoxESRVersions = []int{115, 128, 140}
+
+// GetGeckoVersion returns the Firefox version reported by Gecko based browsers, Tor Browser reports the ESR it is built on.
+func GetGeckoVersion(browserInfo ImpersonateBrowser) int {
+	version := browserInfo.Version
+	if version == 0 {
+		version = GetLatestVersion(browserInfo.Type)
+	}
+	if browserInfo.Type == BrowserTorBrowser {
+		return torBrowserESRVersions[version]
+	}
+	return version
+}
+
+// GetSafariVersion returns the Version/ token of Safari. On iOS Safari ships with the OS, so it follows the iOS version.
+// Other iOS browsers report the Safari version of the WebKit they embed.
+func GetSafariVersion(impersonateOption ImpersonateOption) string {
+	if impersonateOption.OS == IOS {
+		return formatOSVersion(impersonateOption.GetOSVersion(), 2, ".")
+	}
+	if impersonateOption.Browser.Version != 0 {
+		return fmt.Sprintf("%d.0", impersonateOption.Browser.Version)
+	}
+	return "26.0.1"
+}
+
+// GetSecChPlatformVersion returns the Sec-Ch-Ua-Platform-Version value for the OS version.
+// Windows reports the UniversalApiContract version, which is how Windows 11 can be told apart from Windows 10.
+func GetSecChPlatformVersion(impersonateOption ImpersonateOption) string {
+	version := impersonateOption.GetOSVersion()
+	switch impersonateOption.OS {
+	case Windows:
+		if version == "11" {
+			return `"19.0.0"`
+		}
+		return `"10.0.0"`
+	case Linux:
+		return `""`
+	default:
+		return `"` + formatOSVersion(version, 3, ".") + `"`
+	}
+}
+
+// Checks OSVersion is something the OS actually shipped as.
+func validateOSVersion(impersonateOption ImpersonateOption) bool {
+	if impersonateOption.OSVersion == "" && impersonateOption.Device.OSVersion == "" {
+		return true
+	}
+	if impersonateOption.OS == Windows {
+		return impersonateOption.GetOSVersion() == "10" || impersonateOption.GetOSVersion() == "11"
+	}
+	numbers := parseOSVersion(impersonateOption.GetOSVersion())
+	if len(numbers) == 0 || len(numbers) > 3 {
+		return false
+	}
+	switch impersonateOption.OS {
+	case IOS:
+		return slices.Contains(SafariVersions, numbers[0])
+	case MacOS:
+		return (numbers[0] == 10 && len(numbers) > 1 && numbers[1] >= 15) || (numbers[0] >= 11 && numbers[0] <= 15) || numbers[0] == 26
+	case Android:
+		return numbers[0] >= 8 && numbers[0] <= 16
+	default:
+		return false
+	}
+}
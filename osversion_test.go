@@ -0,0 +1,177 @@
+package browser_impersonate
+
+import "testing"
+
+func TestGetOSVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   string
+	}{
+		{name: "set", option: ImpersonateOption{OS: Android, OSVersion: "14"}, want: "14"},
+		{name: "default", option: ImpersonateOption{OS: MacOS}, want: "26.0.1"},
+		{name: "linux", option: ImpersonateOption{OS: Linux}, want: ""},
+		{name: "safari 17 on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}}, want: "17.7"},
+		{name: "safari 17 on ios with OSVersion", option: ImpersonateOption{OS: IOS, OSVersion: "17.2", Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}}, want: "17.2"},
+		{name: "latest safari on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari}}, want: "26.1"},
+		{name: "safari 17 on macos", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}}, want: "26.0.1"},
+		{name: "chrome on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 17}}, want: "26.1"},
+	}
+	for _, test := range tests {
+		if got := test.option.GetOSVersion(); got != test.want {
+			t.Errorf("%s: GetOSVersion() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetIOSUserAgentVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{version: "26.1", want: "18_7"},
+		{version: "18.7", want: "18_7"},
+		{version: "17.5.1", want: "17_5_1"},
+		{version: "16.0.0", want: "16_0"},
+		{version: "15", want: "15_0"},
+	}
+	for _, test := range tests {
+		if got := getIOSUserAgentVersion(test.version); got != test.want {
+			t.Errorf("getIOSUserAgentVersion(%q) = %q, want %q", test.version, got, test.want)
+		}
+	}
+}
+
+func TestGetSafariVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   string
+	}{
+		{name: "ios 17", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}}, want: "17.7"},
+		{name: "ios OSVersion", option: ImpersonateOption{OS: IOS, OSVersion: "18.2.1", Browser: ImpersonateBrowser{Type: BrowserSafari}}, want: "18.2"},
+		{name: "macos 17", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}}, want: "17.0"},
+		{name: "latest on macos", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}}, want: "26.0.1"},
+	}
+	for _, test := range tests {
+		if got := GetSafariVersion(test.option); got != test.want {
+			t.Errorf("%s: GetSafariVersion() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetSecChPlatformVersion(t *testing.T) {
+	tests := []struct {
+		option ImpersonateOption
+		want   string
+	}{
+		{option: ImpersonateOption{OS: Windows, OSVersion: "11"}, want: `"19.0.0"`},
+		{option: ImpersonateOption{OS: Windows}, want: `"10.0.0"`},
+		{option: ImpersonateOption{OS: Linux}, want: `""`},
+		{option: ImpersonateOption{OS: Android, OSVersion: "14"}, want: `"14.0.0"`},
+		{option: ImpersonateOption{OS: MacOS}, want: `"26.0.1"`},
+	}
+	for _, test := range tests {
+		if got := GetSecChPlatformVersion(test.option); got != test.want {
+			t.Errorf("GetSecChPlatformVersion(%s %q) = %s, want %s", test.option.OS, test.option.OSVersion, got, test.want)
+		}
+	}
+}
+
+func TestValidateOSVersion(t *testing.T) {
+	tests := []struct {
+		os      ImpersonateOS
+		version string
+		want    bool
+	}{
+		{os: Windows, version: "", want: true},
+		{os: Windows, version: "11", want: true},
+		{os: Windows, version: "12", want: false},
+		{os: IOS, version: "17.5", want: true},
+		{os: IOS, version: "19.0", want: false},
+		{os: MacOS, version: "10.15.7", want: true},
+		{os: MacOS, version: "10.14", want: false},
+		{os: MacOS, version: "15.1", want: true},
+		{os: Android, version: "7", want: false},
+		{os: Android, version: "15", want: true},
+		{os: Android, version: "15.a", want: false},
+		{os: Linux, version: "6.1", want: false},
+	}
+	for _, test := range tests {
+		if got := validateOSVersion(ImpersonateOption{OS: test.os, OSVersion: test.version}); got != test.want {
+			t.Errorf("validateOSVersion(%s %q) = %t, want %t", test.os, test.version, got, test.want)
+		}
+	}
+}
+
+func TestGetChromeFullVersion(t *testing.T) {
+	tests := []struct {
+		major int
+		want  string
+	}{
+		{major: 142, want: "142.0.7444.46"},
+		{major: 120, want: "120.0.6099.109"},
+		{major: 143, want: "143.0.7504.0"},
+	}
+	for _, test := range tests {
+		if got := GetChromeFullVersion(test.major); got != test.want {
+			t.Errorf("GetChromeFullVersion(%d) = %q, want %q", test.major, got, test.want)
+		}
+	}
+}
+
+func TestGetVendorVersions(t *testing.T) {
+	tests := []struct {
+		chromium    int
+		wantSamsung string
+		wantYandex  string
+	}{
+		{chromium: 121, wantSamsung: "25.0", wantYandex: "24.3"},
+		{chromium: 127, wantSamsung: "26.0", wantYandex: "24.9"},
+		{chromium: 136, wantSamsung: "29.0", wantYandex: "25.6"},
+		{chromium: 140, wantSamsung: "29.0", wantYandex: "25.10"},
+		{chromium: 143, wantSamsung: "29.0", wantYandex: "26.1"},
+	}
+	for _, test := range tests {
+		if got := GetSamsungInternetVersion(test.chromium); got != test.wantSamsung {
+			t.Errorf("GetSamsungInternetVersion(%d) = %q, want %q", test.chromium, got, test.wantSamsung)
+		}
+		if got := GetYandexVersion(test.chromium); got != test.wantYandex {
+			t.Errorf("GetYandexVersion(%d) = %q, want %q", test.chromium, got, test.wantYandex)
+		}
+	}
+}
+
+func TestGetEdgeFullVersion(t *testing.T) {
+	tests := []struct {
+		major int
+		want  string
+	}{
+		{major: 142, want: "142.0.3595.66"},
+		{major: 140, want: "140.0.3485.66"},
+	}
+	for _, test := range tests {
+		if got := GetEdgeFullVersion(test.major); got != test.want {
+			t.Errorf("GetEdgeFullVersion(%d) = %q, want %q", test.major, got, test.want)
+		}
+	}
+}
+
+func TestGetGeckoVersion(t *testing.T) {
+	tests := []struct {
+		browser ImpersonateBrowser
+		want    int
+	}{
+		{browser: ImpersonateBrowser{Type: BrowserFirefox}, want: LatestFirefoxVersion},
+		{browser: ImpersonateBrowser{Type: BrowserFirefox, Version: 140}, want: 140},
+		{browser: ImpersonateBrowser{Type: BrowserFirefoxESR}, want: 140},
+		{browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 128}, want: 128},
+		{browser: ImpersonateBrowser{Type: BrowserTorBrowser, Version: 13}, want: 115},
+		{browser: ImpersonateBrowser{Type: BrowserTorBrowser}, want: 140},
+	}
+	for _, test := range tests {
+		if got := GetGeckoVersion(test.browser); got != test.want {
+			t.Errorf("GetGeckoVersion(%s %d) = %d, want %d", test.browser.Type, test.browser.Version, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package browser_impersonate
+
+// HTTP2Priority is the RFC 7540 priority of a stream, as put on HEADERS and PRIORITY frames.
+// Weight is the wire value, the actual weight minus one. The zero value means no priority is sent.
+type HTTP2Priority struct {
+	StreamDep uint32
+	Exclusive bool
+	Weight    uint8
+}
+
+// HTTP2PriorityFrame is a PRIORITY frame sent right after the connection preface.
+type HTTP2PriorityFrame struct {
+	StreamID uint32
+	HTTP2Priority
+}
+
+// Chromium net::RequestPriority weights, HIGHEST is used for navigations.
+const (
+	chromiumWeightHighest uint8 = 255
+	chromiumWeightMedium  uint8 = 219
+	chromiumWeightLow     uint8 = 182
+	chromiumWeightLowest  uint8 = 146
+)
+
+// Firefox before 120 grouped its streams under idle streams opened with PRIORITY frames.
+const (
+	firefoxStreamLeaders     uint32 = 3
+	firefoxStreamFollowers   uint32 = 5
+	firefoxStreamUnblocked   uint32 = 7
+	firefoxStreamBackground  uint32 = 9
+	firefoxStreamSpeculative uint32 = 11
+	firefoxStreamUrgentStart uint32 = 13
+)
+
+func usesFirefoxPriorityTree(impersonateOption ImpersonateOption) bool {
+	return impersonateOption.Browser.Type.IsGecko() && !impersonateOption.UsesWebKit() && GetGeckoVersion(impersonateOption.Browser) < 120
+}
+
+// GetHTTP2PriorityFrames returns the PRIORITY frames the browser opens every HTTP2 connection with.
+func GetHTTP2PriorityFrames(impersonateOption ImpersonateOption) []HTTP2PriorityFrame {
+	if !usesFirefoxPriorityTree(impersonateOption) {
+		return nil
+	}
+	return []HTTP2PriorityFrame{
+		{StreamID: firefoxStreamLeaders, HTTP2Priority: HTTP2Priority{Weight: 200}},
+		{StreamID: firefoxStreamFollowers, HTTP2Priority: HTTP2Priority{Weight: 100}},
+		{StreamID: firefoxStreamUnblocked, HTTP2Priority: HTTP2Priority{Weight: 0}},
+		{StreamID: firefoxStreamBackground, HTTP2Priority: HTTP2Priority{StreamDep: firefoxStreamUnblocked, Weight: 0}},
+		{StreamID: firefoxStreamSpeculative, HTTP2Priority: HTTP2Priority{StreamDep: firefoxStreamLeaders, Weight: 0}},
+		{StreamID: firefoxStreamUrgentStart, HTTP2Priority: HTTP2Priority{Weight: 240}},
+	}
+}
+
+// GetHTTP2Priority returns the priority the browser puts on the HEADERS frame of a request to the destination.
+// Both fhttp forks keep one HEADERS priority per transport, the backends only send the one of DestinationDocument.
+// Subresources get theirs through the Priority header of RequestHints, not on their HEADERS frames.
+func GetHTTP2Priority(impersonateOption ImpersonateOption, destination FetchDestination) HTTP2Priority {
+	switch {
+	case impersonateOption.Browser.Type.IsNativeApp():
+		return HTTP2Priority{}
+	case impersonateOption.UsesWebKit():
+		// WebKit moved to the Priority header along with SETTINGS_NO_RFC7540_PRIORITIES
+		webKitVersion := 26
+		if numbers := parseOSVersion(GetSafariVersion(impersonateOption)); len(numbers) > 0 {
+			webKitVersion = numbers[0]
+		}
+		if webKitVersion >= 18 {
+			return HTTP2Priority{}
+		}
+		return HTTP2Priority{Weight: 255}
+	case usesFirefoxPriorityTree(impersonateOption):
+		switch destination {
+		case DestinationDocument, DestinationIframe:
+			return HTTP2Priority{StreamDep: firefoxStreamUrgentStart, Weight: 41}
+		case DestinationStyle, DestinationScript:
+			return HTTP2Priority{StreamDep: firefoxStreamLeaders, Weight: 31}
+		case DestinationImage:
+			return HTTP2Priority{StreamDep: firefoxStreamFollowers, Weight: 21}
+		default:
+			return HTTP2Priority{StreamDep: firefoxStreamUnblocked, Weight: 31}
+		}
+	case impersonateOption.Browser.Type.IsGecko():
+		// Without the tree Firefox weights every stream alike, the urgency is in the Priority header.
+		return HTTP2Priority{Weight: 41}
+	default:
+		switch destination {
+		case DestinationDocument, DestinationIframe, DestinationStyle, DestinationFont:
+			return HTTP2Priority{Exclusive: true, Weight: chromiumWeightHighest}
+		case DestinationScript, DestinationEmpty:
+			return HTTP2Priority{Exclusive: true, Weight: chromiumWeightMedium}
+		case DestinationImage:
+			return HTTP2Priority{Exclusive: true, Weight: chromiumWeightLowest}
+		default:
+			return HTTP2Priority{Exclusive: true, Weight: chromiumWeightLow}
+		}
+	}
+}
+
+// GetPriorityHeader returns the RFC 9218 Priority header value the browser sends for the destination.
+// Urgency 3 is the default and is left out, as Chromium does for images.
+func GetPriorityHeader(impersonateOption ImpersonateOption, destination FetchDestination) string {
+	switch {
+	case impersonateOption.UsesWebKit():
+		switch destination {
+		case DestinationDocument, DestinationIframe:
+			return "u=0, i"
+		case DestinationStyle, DestinationFont:
+			return "u=1"
+		case DestinationScript:
+			return "u=2"
+		case DestinationImage:
+			return "u=5, i"
+		default:
+			return "i"
+		}
+	case impersonateOption.Browser.Type.IsGecko():
+		switch destination {
+		case DestinationDocument:
+			return "u=0, i"
+		case DestinationIframe:
+			return "u=4, i"
+		case DestinationStyle, DestinationScript:
+			return "u=2"
+		case DestinationImage:
+			return "u=5, i"
+		case DestinationEmpty:
+			return "u=4"
+		default:
+			return "u=3"
+		}
+	default:
+		switch destination {
+		case DestinationDocument, DestinationIframe:
+			return "u=0, i"
+		case DestinationStyle, DestinationFont:
+			return "u=0"
+		case DestinationScript:
+			return "u=1"
+		case DestinationEmpty:
+			return "u=1, i"
+		default:
+			return "i"
+		}
+	}
+}
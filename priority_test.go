@@ -0,0 +1,101 @@
+package browser_impersonate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetHTTP2PriorityFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   []HTTP2PriorityFrame
+	}{
+		{name: "chrome", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}},
+		{name: "firefox", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}},
+		{name: "firefox esr 128", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 128}}},
+		{
+			name:   "firefox esr 115",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 115}},
+			want: []HTTP2PriorityFrame{
+				{StreamID: 3, HTTP2Priority: HTTP2Priority{Weight: 200}},
+				{StreamID: 5, HTTP2Priority: HTTP2Priority{Weight: 100}},
+				{StreamID: 7, HTTP2Priority: HTTP2Priority{Weight: 0}},
+				{StreamID: 9, HTTP2Priority: HTTP2Priority{StreamDep: 7, Weight: 0}},
+				{StreamID: 11, HTTP2Priority: HTTP2Priority{StreamDep: 3, Weight: 0}},
+				{StreamID: 13, HTTP2Priority: HTTP2Priority{Weight: 240}},
+			},
+		},
+		{name: "firefox on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserFirefox, Version: 115}}},
+	}
+	for _, test := range tests {
+		if got := GetHTTP2PriorityFrames(test.option); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: GetHTTP2PriorityFrames() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetHTTP2Priority(t *testing.T) {
+	chrome := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}
+	firefox := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}
+	firefoxESR115 := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 115}}
+	tests := []struct {
+		name        string
+		option      ImpersonateOption
+		destination FetchDestination
+		want        HTTP2Priority
+	}{
+		{name: "chrome document", option: chrome, destination: DestinationDocument, want: HTTP2Priority{Exclusive: true, Weight: 255}},
+		{name: "chrome font", option: chrome, destination: DestinationFont, want: HTTP2Priority{Exclusive: true, Weight: 255}},
+		{name: "chrome script", option: chrome, destination: DestinationScript, want: HTTP2Priority{Exclusive: true, Weight: 219}},
+		{name: "chrome image", option: chrome, destination: DestinationImage, want: HTTP2Priority{Exclusive: true, Weight: 146}},
+		{name: "firefox document", option: firefox, destination: DestinationDocument, want: HTTP2Priority{Weight: 41}},
+		{name: "firefox image", option: firefox, destination: DestinationImage, want: HTTP2Priority{Weight: 41}},
+		{name: "firefox esr 115 document", option: firefoxESR115, destination: DestinationDocument, want: HTTP2Priority{StreamDep: 13, Weight: 41}},
+		{name: "firefox esr 115 script", option: firefoxESR115, destination: DestinationScript, want: HTTP2Priority{StreamDep: 3, Weight: 31}},
+		{name: "firefox esr 115 image", option: firefoxESR115, destination: DestinationImage, want: HTTP2Priority{StreamDep: 5, Weight: 21}},
+		{name: "firefox esr 115 fetch", option: firefoxESR115, destination: DestinationEmpty, want: HTTP2Priority{StreamDep: 7, Weight: 31}},
+		{name: "safari 26", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 26}}, destination: DestinationDocument},
+		{name: "safari 17", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 17}}, destination: DestinationDocument, want: HTTP2Priority{Weight: 255}},
+		{name: "okhttp", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}}, destination: DestinationDocument},
+	}
+	for _, test := range tests {
+		if got := GetHTTP2Priority(test.option, test.destination); got != test.want {
+			t.Errorf("%s: GetHTTP2Priority() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetPriorityHeader(t *testing.T) {
+	chrome := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}
+	firefox := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}
+	safari := ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}}
+	tests := []struct {
+		name        string
+		option      ImpersonateOption
+		destination FetchDestination
+		want        string
+	}{
+		{name: "chrome document", option: chrome, destination: DestinationDocument, want: "u=0, i"},
+		{name: "chrome style", option: chrome, destination: DestinationStyle, want: "u=0"},
+		{name: "chrome script", option: chrome, destination: DestinationScript, want: "u=1"},
+		{name: "chrome fetch", option: chrome, destination: DestinationEmpty, want: "u=1, i"},
+		{name: "chrome image", option: chrome, destination: DestinationImage, want: "i"},
+		{name: "firefox document", option: firefox, destination: DestinationDocument, want: "u=0, i"},
+		{name: "firefox iframe", option: firefox, destination: DestinationIframe, want: "u=4, i"},
+		{name: "firefox script", option: firefox, destination: DestinationScript, want: "u=2"},
+		{name: "firefox image", option: firefox, destination: DestinationImage, want: "u=5, i"},
+		{name: "firefox fetch", option: firefox, destination: DestinationEmpty, want: "u=4"},
+		{name: "firefox font", option: firefox, destination: DestinationFont, want: "u=3"},
+		{name: "safari document", option: safari, destination: DestinationDocument, want: "u=0, i"},
+		{name: "safari font", option: safari, destination: DestinationFont, want: "u=1"},
+		{name: "safari script", option: safari, destination: DestinationScript, want: "u=2"},
+		{name: "safari image", option: safari, destination: DestinationImage, want: "u=5, i"},
+		{name: "safari fetch", option: safari, destination: DestinationEmpty, want: "i"},
+	}
+	for _, test := range tests {
+		if got := GetPriorityHeader(test.option, test.destination); got != test.want {
+			t.Errorf("%s: GetPriorityHeader() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package browser_impersonate
+
+import "strings"
+
+// GetProxyConnectHeaderOrder returns the headers of the CONNECT request the browser opens a tunnel through an HTTP proxy with,
+// in the order and casing it writes them on HTTP/1.1.
+// Proxy-Authorization comes last, browsers send it up front once they cached the credentials of the proxy.
+func GetProxyConnectHeaderOrder(impersonateOption ImpersonateOption) []string {
+	if impersonateOption.Browser.Type.IsGecko() {
+		return []string{"User-Agent", "Proxy-Connection", "Connection", "Host", "Proxy-Authorization"}
+	}
+	// Chromium, WebKit and OkHttp
+	return []string{"Host", "Proxy-Connection", "User-Agent", "Proxy-Authorization"}
+}
+
+// GetProxyConnectHeaders returns the headers of the CONNECT request of the browser, Host and Proxy-Authorization aside:
+// the backends write the target in Host and the credentials of the proxy URL in Proxy-Authorization.
+// Connection is only sent by Firefox, it has no value otherwise so the backends write no line for it.
+func GetProxyConnectHeaders(impersonateOption ImpersonateOption) map[string][]string {
+	headers := map[string][]string{
+		"Proxy-Connection": {"keep-alive"},
+		"User-Agent":       {GetUserAgent(impersonateOption)},
+		"Connection":       {},
+	}
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		// OkHttp writes its own User-Agent, whatever the app sets on its requests
+		headers["Proxy-Connection"] = []string{"Keep-Alive"}
+		return headers
+	case impersonateOption.Browser.Type.IsGecko():
+		headers["Connection"] = []string{"keep-alive"}
+	}
+	for key, value := range impersonateOption.OverwriteHeaders {
+		if strings.EqualFold(key, "User-Agent") {
+			headers["User-Agent"] = []string{value}
+		}
+	}
+	return headers
+}
+
+// GetProxyConnectHeaderOrderKey returns GetProxyConnectHeaderOrder lowercased, as the fhttp header sorters expect it.
+func GetProxyConnectHeaderOrderKey(impersonateOption ImpersonateOption) []string {
+	order := GetProxyConnectHeaderOrder(impersonateOption)
+	lower := make([]string, len(order))
+	for i, name := range order {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
@@ -0,0 +1,297 @@
+package browser_impersonate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	_ "github.com/Noooste/go-socks4"
+	"golang.org/x/net/proxy"
+)
+
+// ProxySchemes are the proxy URL schemes a ProxyPool accepts.
+var ProxySchemes = []string{"http", "https", "socks4", "socks4a", "socks5", "socks5h"}
+
+// ErrNoProxy is returned when no healthy proxy of the pool can serve a key.
+var ErrNoProxy = errors.New("browser_impersonate: no healthy proxy in the pool")
+
+// ProxyPoolOptions configure when a ProxyPool moves keys to other proxies and how it checks them.
+type ProxyPoolOptions struct {
+	RotateOn           func(statusCode int, err error) bool // Results moving a key to another proxy, DefaultProxyRotateOn when nil
+	MaxFailures        int                                  // Consecutive failures taking a proxy out until its next passed health check, 3 when 0
+	HealthCheckURL     string                               // Endpoint fetched through each proxy by CheckHealth, a local server answering 2xx
+	HealthCheckTimeout time.Duration                        // 10 seconds when 0
+}
+
+// DefaultProxyRotateOn rotates on connection errors, rejected proxy credentials, rate limiting and gateway errors of the proxy.
+// Requests canceled by the caller say nothing about the proxy.
+func DefaultProxyRotateOn(statusCode int, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch statusCode {
+	case http.StatusProxyAuthRequired, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// ProxyStats are the counters of a proxy of the pool, its URL has the password redacted.
+type ProxyStats struct {
+	URL                 string
+	Healthy             bool
+	Keys                int // Keys bound to the proxy
+	Requests            int
+	Failures            int
+	ConsecutiveFailures int
+	Rotations           int // Keys moved away from the proxy
+	LastError           string
+	LastHealthCheck     time.Time
+	Latency             time.Duration // Of the last passed health check
+}
+
+type pooledProxy struct {
+	url   *url.URL
+	raw   string
+	stats ProxyStats
+}
+
+// ProxyPool binds keys, one per persona, to proxies: a key keeps its proxy until a result the pool rotates on,
+// as a browser keeps its address. New keys go to the healthy proxy with the fewest keys.
+type ProxyPool struct {
+	mu       sync.Mutex
+	options  ProxyPoolOptions
+	proxies  []*pooledProxy
+	bindings map[string]*pooledProxy
+	next     int
+}
+
+// NewProxyPool returns a pool of the proxy URLs, all healthy until checked.
+func NewProxyPool(proxies []string, options ProxyPoolOptions) (*ProxyPool, error) {
+	if len(proxies) == 0 {
+		return nil, errors.New("browser_impersonate: empty proxy pool")
+	}
+	if options.RotateOn == nil {
+		options.RotateOn = DefaultProxyRotateOn
+	}
+	if options.MaxFailures == 0 {
+		options.MaxFailures = 3
+	}
+	if options.HealthCheckTimeout == 0 {
+		options.HealthCheckTimeout = 10 * time.Second
+	}
+	pool := &ProxyPool{options: options, bindings: map[string]*pooledProxy{}}
+	for _, raw := range proxies {
+		proxyURL, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ProxySchemes, proxyURL.Scheme) || proxyURL.Host == "" {
+			return nil, fmt.Errorf("browser_impersonate: unsupported proxy %q", proxyURL.Redacted())
+		}
+		pool.proxies = append(pool.proxies, &pooledProxy{url: proxyURL, raw: raw, stats: ProxyStats{URL: proxyURL.Redacted(), Healthy: true}})
+	}
+	return pool, nil
+}
+
+// Acquire returns the proxy bound to key, binding it to one first when it has none or its proxy is no longer usable.
+// Schemes restrict the proxies to those the backend supports, any scheme when empty.
+func (p *ProxyPool) Acquire(key string, schemes ...string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bound, ok := p.bindings[key]; ok && p.usable(bound, schemes) {
+		return bound.raw, nil
+	}
+	return p.bind(key, nil, schemes)
+}
+
+// Rotate moves key to another proxy, it stays on its proxy when no other one is usable.
+func (p *ProxyPool) Rotate(key string, schemes ...string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bind(key, p.bindings[key], schemes)
+}
+
+// Release forgets the proxy of key, once its persona is retired.
+func (p *ProxyPool) Release(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bound, ok := p.bindings[key]; ok {
+		bound.stats.Keys--
+		delete(p.bindings, key)
+	}
+}
+
+// Report records the result of a request key made through proxyURL, a status code of 0 when it failed with err.
+// It returns the proxy key is bound to afterwards and whether it changed, a backend then switches to it.
+func (p *ProxyPool) Report(key string, proxyURL string, statusCode int, err error, schemes ...string) (string, bool) {
+	if errors.Is(err, context.Canceled) {
+		// Requests canceled by the caller say nothing about the proxy, whatever RotateOn says
+		return proxyURL, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	used := p.find(proxyURL)
+	if used == nil {
+		return proxyURL, false
+	}
+	used.stats.Requests++
+	if !p.options.RotateOn(statusCode, err) {
+		used.stats.ConsecutiveFailures = 0
+		return proxyURL, false
+	}
+	used.stats.Failures++
+	used.stats.ConsecutiveFailures++
+	used.stats.LastError = http.StatusText(statusCode)
+	if err != nil {
+		used.stats.LastError = err.Error()
+	}
+	if used.stats.ConsecutiveFailures >= p.options.MaxFailures {
+		used.stats.Healthy = false
+	}
+	if bound, ok := p.bindings[key]; ok && bound != used {
+		// Already moved by a concurrent request
+		return bound.raw, bound.raw != proxyURL
+	}
+	next, err := p.bind(key, used, schemes)
+	if err != nil || next == proxyURL {
+		return proxyURL, false
+	}
+	return next, true
+}
+
+// Stats returns the counters of the proxies, in the order the pool was created with.
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]ProxyStats, len(p.proxies))
+	for i, pooled := range p.proxies {
+		stats[i] = pooled.stats
+	}
+	return stats
+}
+
+// CheckHealth fetches HealthCheckURL through every proxy at once, a proxy is healthy when it answered with a 2xx status.
+// Proxies taken out after failures come back once they pass.
+func (p *ProxyPool) CheckHealth(ctx context.Context) error {
+	if p.options.HealthCheckURL == "" {
+		return errors.New("browser_impersonate: no HealthCheckURL to check the proxies against")
+	}
+	var wg sync.WaitGroup
+	for _, pooled := range p.proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := p.checkProxy(ctx, pooled.url)
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			pooled.stats.LastHealthCheck = time.Now()
+			pooled.stats.Healthy = err == nil
+			if err != nil {
+				pooled.stats.LastError = err.Error()
+				return
+			}
+			pooled.stats.ConsecutiveFailures = 0
+			pooled.stats.Latency = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// StartHealthChecks runs CheckHealth every interval until ctx is done.
+func (p *ProxyPool) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.CheckHealth(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *ProxyPool) checkProxy(ctx context.Context, proxyURL *url.URL) error {
+	ctx, cancel := context.WithTimeout(ctx, p.options.HealthCheckTimeout)
+	defer cancel()
+	transport := &http.Transport{DisableKeepAlives: true, Proxy: http.ProxyURL(proxyURL)}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		dialer, err := proxy.FromURL(proxyURL, &net.Dialer{})
+		if err != nil {
+			return err
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return fmt.Errorf("browser_impersonate: no context dialer for %s proxies", proxyURL.Scheme)
+		}
+		transport = &http.Transport{DisableKeepAlives: true, DialContext: contextDialer.DialContext}
+	}
+	defer transport.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.options.HealthCheckURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("browser_impersonate: health check answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *ProxyPool) find(raw string) *pooledProxy {
+	for _, pooled := range p.proxies {
+		if pooled.raw == raw {
+			return pooled
+		}
+	}
+	return nil
+}
+
+func (p *ProxyPool) usable(pooled *pooledProxy, schemes []string) bool {
+	return pooled.stats.Healthy && (len(schemes) == 0 || slices.Contains(schemes, pooled.url.Scheme))
+}
+
+// bind binds key to the usable proxy with the fewest keys other than current, round robin among equals.
+func (p *ProxyPool) bind(key string, current *pooledProxy, schemes []string) (string, error) {
+	var best *pooledProxy
+	for i := range p.proxies {
+		pooled := p.proxies[(p.next+i)%len(p.proxies)]
+		if pooled == current || !p.usable(pooled, schemes) {
+			continue
+		}
+		if best == nil || pooled.stats.Keys < best.stats.Keys {
+			best = pooled
+		}
+	}
+	if best == nil {
+		if current != nil && p.usable(current, schemes) {
+			return current.raw, nil
+		}
+		return "", ErrNoProxy
+	}
+	p.next++
+	if bound, ok := p.bindings[key]; ok {
+		bound.stats.Keys--
+		bound.stats.Rotations++
+	}
+	best.stats.Keys++
+	p.bindings[key] = best
+	return best.raw, nil
+}
@@ -0,0 +1,255 @@
+package browser_impersonate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestProxy returns an HTTP proxy tunneling CONNECT requests and answering proxied requests itself with status,
+// or refusing both with status when it is not 2xx.
+func newTestProxy(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status < 200 || status > 299 || r.Method != http.MethodConnect {
+			w.WriteHeader(status)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, buffered, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go func() {
+			io.Copy(upstream, buffered)
+			upstream.(*net.TCPConn).CloseWrite()
+		}()
+		io.Copy(conn, upstream)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProxyPool(t *testing.T, proxies []string, options ProxyPoolOptions) *ProxyPool {
+	t.Helper()
+	pool, err := NewProxyPool(proxies, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func proxyKeys(pool *ProxyPool) []int {
+	keys := []int{}
+	for _, stats := range pool.Stats() {
+		keys = append(keys, stats.Keys)
+	}
+	return keys
+}
+
+func TestNewProxyPoolRejectsUnsupportedProxies(t *testing.T) {
+	for _, proxies := range [][]string{nil, {"ftp://proxy.example:21"}, {"http://"}} {
+		if _, err := NewProxyPool(proxies, ProxyPoolOptions{}); err == nil {
+			t.Fatalf("%q: got no error", proxies)
+		}
+	}
+}
+
+func TestProxyPoolAcquire(t *testing.T) {
+	pool := newTestProxyPool(t, []string{"http://a.example:8080", "http://b.example:8080", "socks5://c.example:1080"}, ProxyPoolOptions{})
+	first, err := pool.Acquire("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"second", "third", "fourth"} {
+		if _, err := pool.Acquire(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := proxyKeys(pool); keys[0]+keys[1]+keys[2] != 4 || keys[0] == 0 || keys[1] == 0 || keys[2] == 0 {
+		t.Fatalf("got keys %v, want 4 spread over the 3 proxies", keys)
+	}
+	if again, err := pool.Acquire("first"); err != nil || again != first {
+		t.Fatalf("got %q, %v, want %q", again, err, first)
+	}
+	// Schemes the backend supports
+	for range 3 {
+		proxyURL, err := pool.Acquire("http only", "http")
+		if err != nil || proxyURL == "socks5://c.example:1080" {
+			t.Fatalf("got %q, %v", proxyURL, err)
+		}
+		pool.Release("http only")
+	}
+	if _, err := pool.Acquire("socks4 only", "socks4"); !errors.Is(err, ErrNoProxy) {
+		t.Fatalf("got %v, want ErrNoProxy", err)
+	}
+
+	pool.Release("first")
+	if keys := proxyKeys(pool); keys[0]+keys[1]+keys[2] != 3 {
+		t.Fatalf("got keys %v, want 3 once released", keys)
+	}
+}
+
+func TestProxyPoolReport(t *testing.T) {
+	const first, second = "http://a.example:8080", "http://b.example:8080"
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		rotated    bool
+	}{
+		{name: "success", statusCode: http.StatusOK},
+		{name: "server error of the site", statusCode: http.StatusInternalServerError},
+		{name: "rate limited", statusCode: http.StatusTooManyRequests, rotated: true},
+		{name: "proxy authentication", statusCode: http.StatusProxyAuthRequired, rotated: true},
+		{name: "connection error", err: errors.New("connection refused"), rotated: true},
+		{name: "canceled by the caller", err: context.Canceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := newTestProxyPool(t, []string{first, second}, ProxyPoolOptions{})
+			proxyURL, err := pool.Acquire("key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, rotated := pool.Report("key", proxyURL, test.statusCode, test.err)
+			if rotated != test.rotated || rotated == (next == proxyURL) {
+				t.Fatalf("got %q, %v from %q, want rotated %v", next, rotated, proxyURL, test.rotated)
+			}
+			if bound, err := pool.Acquire("key"); err != nil || bound != next {
+				t.Fatalf("bound to %q, %v, want %q", bound, err, next)
+			}
+		})
+	}
+
+	t.Run("concurrent move", func(t *testing.T) {
+		pool := newTestProxyPool(t, []string{first, second}, ProxyPoolOptions{})
+		proxyURL, _ := pool.Acquire("key")
+		next, rotated := pool.Report("key", proxyURL, http.StatusTooManyRequests, nil)
+		if !rotated {
+			t.Fatal("not rotated")
+		}
+		// A request sent through the previous proxy before the move reports after it
+		if again, rotated := pool.Report("key", proxyURL, http.StatusTooManyRequests, nil); !rotated || again != next {
+			t.Fatalf("got %q, %v, want %q, true", again, rotated, next)
+		}
+		if stats := pool.Stats(); stats[0].Rotations+stats[1].Rotations != 1 {
+			t.Fatalf("got %+v, want one rotation", stats)
+		}
+	})
+
+	t.Run("max failures", func(t *testing.T) {
+		pool := newTestProxyPool(t, []string{first, second}, ProxyPoolOptions{MaxFailures: 2})
+		for _, key := range []string{"a", "b"} {
+			if _, err := pool.Acquire(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for range 2 {
+			pool.Report("other", first, 0, errors.New("connection refused"))
+		}
+		stats := pool.Stats()
+		if stats[0].Healthy || stats[0].ConsecutiveFailures != 2 || stats[0].LastError != "connection refused" || !stats[1].Healthy {
+			t.Fatalf("got %+v", stats)
+		}
+		// Keys of the proxy taken out move on their next Acquire
+		for _, key := range []string{"a", "b", "c"} {
+			if proxyURL, err := pool.Acquire(key); err != nil || proxyURL != second {
+				t.Fatalf("%s: got %q, %v, want %q", key, proxyURL, err, second)
+			}
+		}
+		pool.Report("a", second, 0, errors.New("connection refused"))
+		pool.Report("a", second, 0, errors.New("connection refused"))
+		if _, err := pool.Acquire("d"); !errors.Is(err, ErrNoProxy) {
+			t.Fatalf("got %v, want ErrNoProxy", err)
+		}
+	})
+
+	t.Run("canceled after a failure", func(t *testing.T) {
+		pool := newTestProxyPool(t, []string{first}, ProxyPoolOptions{})
+		pool.Report("key", first, 0, errors.New("connection refused"))
+		pool.Report("key", first, 0, context.Canceled)
+		if stats := pool.Stats(); stats[0].Requests != 1 || stats[0].ConsecutiveFailures != 1 {
+			t.Fatalf("got %+v, want the canceled request left out", stats[0])
+		}
+	})
+
+	t.Run("unknown proxy", func(t *testing.T) {
+		pool := newTestProxyPool(t, []string{first, second}, ProxyPoolOptions{})
+		if proxyURL, rotated := pool.Report("key", "http://c.example:8080", http.StatusTooManyRequests, nil); rotated || proxyURL != "http://c.example:8080" {
+			t.Fatalf("got %q, %v", proxyURL, rotated)
+		}
+	})
+}
+
+func TestProxyPoolRotate(t *testing.T) {
+	pool := newTestProxyPool(t, []string{"http://a.example:8080", "http://b.example:8080"}, ProxyPoolOptions{})
+	proxyURL, _ := pool.Acquire("key")
+	next, err := pool.Rotate("key")
+	if err != nil || next == proxyURL {
+		t.Fatalf("got %q, %v from %q", next, err, proxyURL)
+	}
+	if keys := proxyKeys(pool); keys[0]+keys[1] != 1 {
+		t.Fatalf("got keys %v, want the key counted once", keys)
+	}
+	if stats := pool.Stats(); stats[0].Rotations+stats[1].Rotations != 1 {
+		t.Fatalf("got %+v, want one rotation", stats)
+	}
+	// No other usable proxy, the key stays
+	single := newTestProxyPool(t, []string{"http://a.example:8080"}, ProxyPoolOptions{})
+	proxyURL, _ = single.Acquire("key")
+	if again, err := single.Rotate("key"); err != nil || again != proxyURL {
+		t.Fatalf("got %q, %v, want %q", again, err, proxyURL)
+	}
+}
+
+func TestProxyPoolCheckHealth(t *testing.T) {
+	healthy := newTestProxy(t, http.StatusNoContent)
+	failing := newTestProxy(t, http.StatusBadGateway)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := listener.Addr().String()
+	listener.Close()
+
+	pool := newTestProxyPool(t, []string{healthy.URL, failing.URL, "http://" + refused}, ProxyPoolOptions{
+		HealthCheckURL:     "http://health.example/",
+		HealthCheckTimeout: 5 * time.Second,
+		MaxFailures:        1,
+	})
+	if _, rotated := pool.Report("key", healthy.URL, 0, errors.New("connection refused")); !rotated {
+		t.Fatal("not rotated")
+	}
+	if err := pool.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stats := pool.Stats()
+	if !stats[0].Healthy || stats[0].ConsecutiveFailures != 0 || stats[0].LastHealthCheck.IsZero() || stats[0].Latency == 0 {
+		t.Fatalf("got %+v, want healthy again", stats[0])
+	}
+	for _, stats := range stats[1:] {
+		if stats.Healthy || stats.LastError == "" || stats.LastHealthCheck.IsZero() {
+			t.Fatalf("got %+v, want unhealthy", stats)
+		}
+	}
+	if proxyURL, err := pool.Acquire("other"); err != nil || proxyURL != healthy.URL {
+		t.Fatalf("got %q, %v, want %q", proxyURL, err, healthy.URL)
+	}
+
+	if err := newTestProxyPool(t, []string{healthy.URL}, ProxyPoolOptions{}).CheckHealth(context.Background()); err == nil {
+		t.Fatal("got no error without HealthCheckURL")
+	}
+}
@@ -0,0 +1,243 @@
+package browser_impersonate
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// FetchDestination is the Sec-Fetch-Dest of a request, what the browser will do with the response.
+type FetchDestination string
+
+const (
+	DestinationDocument FetchDestination = "document"
+	DestinationIframe   FetchDestination = "iframe"
+	DestinationScript   FetchDestination = "script"
+	DestinationStyle    FetchDestination = "style"
+	DestinationImage    FetchDestination = "image"
+	DestinationFont     FetchDestination = "font"
+	DestinationEmpty    FetchDestination = "empty" // fetch() and XMLHttpRequest
+)
+
+type NavigationType int
+
+const (
+	NavigationTyped       NavigationType = iota // Typed in the address bar or opened from a bookmark
+	NavigationLink                              // Link followed from the Initiator page
+	NavigationReload                            // Reload of the current page
+	NavigationFormSubmit                        // Form submitted from the Initiator page
+	NavigationBackForward                       // History navigation
+)
+
+// RequestHints describe a single request, so its headers can differ from the top-level navigation defaults.
+type RequestHints struct {
+	Destination      FetchDestination // Defaults to DestinationDocument
+	Initiator        string           // URL of the page the request is made from, empty for typed navigations
+	UserActivation   bool             // The navigation was triggered by a user gesture, Sec-Fetch-User
+	Navigation       NavigationType   // Only used for document and iframe destinations
+	OverwriteHeaders map[string]string
+}
+
+type requestHintsKey struct{}
+
+// WithRequestHints attaches the impersonation hints of a request to its context.
+func WithRequestHints(ctx context.Context, hints RequestHints) context.Context {
+	return context.WithValue(ctx, requestHintsKey{}, hints)
+}
+
+// RequestHintsFromContext returns the hints attached with WithRequestHints.
+func RequestHintsFromContext(ctx context.Context) (RequestHints, bool) {
+	if ctx == nil {
+		return RequestHints{}, false
+	}
+	hints, ok := ctx.Value(requestHintsKey{}).(RequestHints)
+	return hints, ok
+}
+
+type AnyHttpHeaderEditor interface {
+	AnyHttpHeader
+	Get(key string) string
+	Del(key string)
+}
+
+// ImpersonateRequestHeaders sets the headers of a single request described by the hints,
+// ImpersonateHeaders only covers typed top-level navigations.
+func ImpersonateRequestHeaders(h AnyHttpHeaderEditor, impersonateOption ImpersonateOption, hints RequestHints, method string, target *url.URL) {
+	overwriteHeaders := map[string]string{}
+	for k, v := range impersonateOption.OverwriteHeaders {
+		overwriteHeaders[k] = v
+	}
+	for k, v := range hints.OverwriteHeaders {
+		overwriteHeaders[k] = v
+	}
+	impersonateOption.OverwriteHeaders = overwriteHeaders
+	ImpersonateHeaders(h, impersonateOption, IsPotentiallyTrustworthy(target))
+	if impersonateOption.Browser.Type.IsNativeApp() {
+		return
+	}
+
+	isOverwritten := func(key string) bool {
+		for k := range overwriteHeaders {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+		return false
+	}
+	hSet := func(key string, value string) {
+		if !isOverwritten(key) {
+			h.Set(key, value)
+		}
+	}
+	hDel := func(key string) {
+		if !isOverwritten(key) {
+			h.Del(key)
+		}
+	}
+
+	destination := hints.Destination
+	if destination == "" {
+		destination = DestinationDocument
+	}
+	isNavigation := destination == DestinationDocument || destination == DestinationIframe
+	var initiator *url.URL
+	if hints.Initiator != "" {
+		initiator, _ = url.Parse(hints.Initiator)
+	}
+
+	// Sec-Fetch headers are only sent to potentially trustworthy origins.
+	if h.Get("Sec-Fetch-Site") != "" {
+		mode := getFetchMode(destination)
+		hSet("Sec-Fetch-Site", getFetchSite(initiator, target))
+		hSet("Sec-Fetch-Mode", mode)
+		hSet("Sec-Fetch-Dest", string(destination))
+		userActivation := hints.UserActivation || (isNavigation && hints.Navigation == NavigationTyped)
+		if mode != "navigate" || !userActivation || impersonateOption.UsesWebKit() && impersonateOption.Browser.Type != BrowserChrome {
+			hDel("Sec-Fetch-User")
+		} else {
+			hSet("Sec-Fetch-User", "?1")
+		}
+	}
+
+	if referer := getReferer(initiator, target); referer != "" {
+		hSet("Referer", referer)
+	}
+	isSameOrigin := initiator != nil && sameOrigin(initiator, target)
+	if (method != "" && method != http.MethodGet && method != http.MethodHead) || (getFetchMode(destination) == "cors" && !isSameOrigin) {
+		origin := "null"
+		if initiator != nil {
+			origin = initiator.Scheme + "://" + initiator.Host
+		}
+		hSet("Origin", origin)
+	}
+
+	// The Priority header is only there when the browser sends it over this transport
+	if h.Get("Priority") != "" {
+		hSet("Priority", GetPriorityHeader(impersonateOption, destination))
+	}
+
+	if isNavigation {
+		if hints.Navigation == NavigationReload || hints.Navigation == NavigationFormSubmit && impersonateOption.Browser.Type.IsChromium() {
+			hSet("Cache-Control", "max-age=0")
+		} else {
+			hDel("Cache-Control")
+		}
+		return
+	}
+
+	// Subresources
+	hDel("Upgrade-Insecure-Requests")
+	hDel("Cache-Control")
+	hDel("X-Requested-With")
+	hSet("Accept", getSubresourceAccept(impersonateOption, destination))
+}
+
+// IsPotentiallyTrustworthy reports whether browsers treat the URL as a secure context: https, or a loopback host.
+func IsPotentiallyTrustworthy(target *url.URL) bool {
+	if target == nil {
+		return true
+	}
+	if target.Scheme == "https" || target.Scheme == "wss" {
+		return true
+	}
+	host := strings.ToLower(target.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// GetRequestHeaderOrder returns the header order of a request to the target, plain http:// is always HTTP/1.1.
+func GetRequestHeaderOrder(impersonateOption ImpersonateOption, target *url.URL) []string {
+	if target != nil && target.Scheme == "http" {
+		return GetHTTP1HeaderOrderKey(impersonateOption)
+	}
+	return GetHeaderOrder(impersonateOption)
+}
+
+func getFetchMode(destination FetchDestination) string {
+	switch destination {
+	case DestinationDocument, DestinationIframe:
+		return "navigate"
+	case DestinationFont, DestinationEmpty:
+		return "cors"
+	default:
+		return "no-cors"
+	}
+}
+
+func sameOrigin(a *url.URL, b *url.URL) bool {
+	return a.Scheme == b.Scheme && a.Host == b.Host
+}
+
+func getFetchSite(initiator *url.URL, target *url.URL) string {
+	if initiator == nil {
+		return "none"
+	}
+	if sameOrigin(initiator, target) {
+		return "same-origin"
+	}
+	initiatorSite, err1 := publicsuffix.EffectiveTLDPlusOne(initiator.Hostname())
+	targetSite, err2 := publicsuffix.EffectiveTLDPlusOne(target.Hostname())
+	if err1 == nil && err2 == nil && initiator.Scheme == target.Scheme && initiatorSite == targetSite {
+		return "same-site"
+	}
+	return "cross-site"
+}
+
+// Referer under the default strict-origin-when-cross-origin policy.
+func getReferer(initiator *url.URL, target *url.URL) string {
+	if initiator == nil || initiator.Scheme == "https" && target.Scheme == "http" {
+		return ""
+	}
+	if sameOrigin(initiator, target) {
+		referer := *initiator
+		referer.Fragment = ""
+		referer.User = nil
+		return referer.String()
+	}
+	return initiator.Scheme + "://" + initiator.Host + "/"
+}
+
+func getSubresourceAccept(impersonateOption ImpersonateOption, destination FetchDestination) string {
+	switch destination {
+	case DestinationStyle:
+		return "text/css,*/*;q=0.1"
+	case DestinationImage:
+		switch {
+		case impersonateOption.UsesWebKit():
+			return "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5"
+		case impersonateOption.Browser.Type.IsGecko():
+			return "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5"
+		default:
+			return "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"
+		}
+	default:
+		return "*/*"
+	}
+}
@@ -0,0 +1,341 @@
+package browser_impersonate
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestRequestHintsFromContext(t *testing.T) {
+	hints := RequestHints{Destination: DestinationScript, Initiator: "https://example.com/"}
+	got, ok := RequestHintsFromContext(WithRequestHints(context.Background(), hints))
+	if !ok || got.Destination != hints.Destination || got.Initiator != hints.Initiator {
+		t.Errorf("RequestHintsFromContext() = %+v, %v, want %+v, true", got, ok, hints)
+	}
+	if _, ok := RequestHintsFromContext(context.Background()); ok {
+		t.Errorf("RequestHintsFromContext() found hints in an empty context")
+	}
+	if _, ok := RequestHintsFromContext(nil); ok {
+		t.Errorf("RequestHintsFromContext() found hints in a nil context")
+	}
+}
+
+func TestImpersonateRequestHeaders(t *testing.T) {
+	chrome := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}
+	firefox := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}}
+	safari := ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}}
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		hints  RequestHints
+		method string
+		target string
+		want   map[string]string // Empty values must be absent
+	}{
+		{
+			name:   "typed navigation",
+			option: chrome,
+			target: "https://example.com/",
+			want: map[string]string{
+				"Sec-Fetch-Site": "none",
+				"Sec-Fetch-Mode": "navigate",
+				"Sec-Fetch-User": "?1",
+				"Sec-Fetch-Dest": "document",
+				"Referer":        "",
+				"Origin":         "",
+				"Cache-Control":  "",
+			},
+		},
+		{
+			name:   "link to the same origin",
+			option: chrome,
+			hints:  RequestHints{Initiator: "https://example.com/a?b=c#d", Navigation: NavigationLink, UserActivation: true},
+			target: "https://example.com/e",
+			want: map[string]string{
+				"Sec-Fetch-Site": "same-origin",
+				"Sec-Fetch-Mode": "navigate",
+				"Sec-Fetch-User": "?1",
+				"Sec-Fetch-Dest": "document",
+				"Referer":        "https://example.com/a?b=c",
+				"Origin":         "",
+			},
+		},
+		{
+			name:   "link to the same site without user activation",
+			option: chrome,
+			hints:  RequestHints{Initiator: "https://www.example.com/a", Navigation: NavigationLink},
+			target: "https://cdn.example.com/",
+			want: map[string]string{
+				"Sec-Fetch-Site": "same-site",
+				"Sec-Fetch-User": "",
+				"Referer":        "https://www.example.com/",
+			},
+		},
+		{
+			name:   "reload",
+			option: chrome,
+			hints:  RequestHints{Initiator: "https://example.com/", Navigation: NavigationReload},
+			target: "https://example.com/",
+			want: map[string]string{
+				"Sec-Fetch-Site": "same-origin",
+				"Cache-Control":  "max-age=0",
+			},
+		},
+		{
+			name:   "form submission",
+			option: chrome,
+			hints:  RequestHints{Initiator: "https://example.com/login", Navigation: NavigationFormSubmit, UserActivation: true},
+			method: http.MethodPost,
+			target: "https://example.com/session",
+			want: map[string]string{
+				"Sec-Fetch-Site": "same-origin",
+				"Sec-Fetch-Mode": "navigate",
+				"Sec-Fetch-User": "?1",
+				"Origin":         "https://example.com",
+				"Referer":        "https://example.com/login",
+				"Cache-Control":  "max-age=0",
+			},
+		},
+		{
+			name:   "form submission on firefox",
+			option: firefox,
+			hints:  RequestHints{Initiator: "https://example.com/login", Navigation: NavigationFormSubmit, UserActivation: true},
+			method: http.MethodPost,
+			target: "https://example.com/session",
+			want: map[string]string{
+				"Origin":        "https://example.com",
+				"Cache-Control": "",
+			},
+		},
+		{
+			name:   "cross-site script",
+			option: chrome,
+			hints:  RequestHints{Destination: DestinationScript, Initiator: "https://example.com/"},
+			target: "https://cdn.example.net/app.js",
+			want: map[string]string{
+				"Sec-Fetch-Site":            "cross-site",
+				"Sec-Fetch-Mode":            "no-cors",
+				"Sec-Fetch-User":            "",
+				"Sec-Fetch-Dest":            "script",
+				"Accept":                    "*/*",
+				"Referer":                   "https://example.com/",
+				"Origin":                    "",
+				"Upgrade-Insecure-Requests": "",
+				"Priority":                  "u=1",
+			},
+		},
+		{
+			name:   "cross-origin fetch",
+			option: chrome,
+			hints:  RequestHints{Destination: DestinationEmpty, Initiator: "https://example.com/"},
+			target: "https://api.example.com/",
+			want: map[string]string{
+				"Sec-Fetch-Site": "same-site",
+				"Sec-Fetch-Mode": "cors",
+				"Sec-Fetch-Dest": "empty",
+				"Origin":         "https://example.com",
+			},
+		},
+		{
+			name:   "image on chrome",
+			option: chrome,
+			hints:  RequestHints{Destination: DestinationImage, Initiator: "https://example.com/"},
+			target: "https://example.com/a.png",
+			want:   map[string]string{"Accept": "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"},
+		},
+		{
+			name:   "image on firefox",
+			option: firefox,
+			hints:  RequestHints{Destination: DestinationImage, Initiator: "https://example.com/"},
+			target: "https://example.com/a.png",
+			want:   map[string]string{"Accept": "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5"},
+		},
+		{
+			name:   "image on safari",
+			option: safari,
+			hints:  RequestHints{Destination: DestinationImage, Initiator: "https://example.com/"},
+			target: "https://example.com/a.png",
+			want:   map[string]string{"Accept": "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5"},
+		},
+		{
+			name:   "image priority on firefox",
+			option: firefox,
+			hints:  RequestHints{Destination: DestinationImage, Initiator: "https://example.com/"},
+			target: "https://example.com/a.png",
+			want:   map[string]string{"Priority": "u=5, i"},
+		},
+		{
+			name:   "stylesheet",
+			option: firefox,
+			hints:  RequestHints{Destination: DestinationStyle, Initiator: "https://example.com/"},
+			target: "https://example.com/a.css",
+			want:   map[string]string{"Accept": "text/css,*/*;q=0.1", "Sec-Fetch-Mode": "no-cors"},
+		},
+		{
+			name:   "safari never sends Sec-Fetch-User",
+			option: safari,
+			target: "https://example.com/",
+			want:   map[string]string{"Sec-Fetch-Mode": "navigate", "Sec-Fetch-User": ""},
+		},
+		{
+			name:   "downgrade to http",
+			option: chrome,
+			hints:  RequestHints{Initiator: "https://example.com/", Navigation: NavigationLink},
+			target: "http://example.net/",
+			want:   map[string]string{"Referer": ""},
+		},
+		{
+			name:   "overwritten by the hints",
+			option: chrome,
+			hints:  RequestHints{Destination: DestinationScript, OverwriteHeaders: map[string]string{"accept": "application/javascript", "Sec-Fetch-Site": "same-origin"}},
+			target: "https://example.com/app.js",
+			want:   map[string]string{"Accept": "application/javascript", "Sec-Fetch-Site": "same-origin", "Sec-Fetch-Dest": "script"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := http.Header{}
+			ImpersonateRequestHeaders(h, test.option, test.hints, test.method, target)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsPotentiallyTrustworthy(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: "https://example.com/", want: true},
+		{target: "wss://example.com/", want: true},
+		{target: "http://example.com/", want: false},
+		{target: "ws://example.com/", want: false},
+		{target: "http://localhost:8080/", want: true},
+		{target: "http://app.localhost/", want: true},
+		{target: "http://127.0.0.1/", want: true},
+		{target: "http://[::1]/", want: true},
+		{target: "http://10.0.0.1/", want: false},
+	}
+	for _, test := range tests {
+		target, err := url.Parse(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := IsPotentiallyTrustworthy(target); got != test.want {
+			t.Errorf("IsPotentiallyTrustworthy(%q) = %v, want %v", test.target, got, test.want)
+		}
+	}
+}
+
+func TestImpersonateRequestHeadersPlainHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		want   map[string]string // Empty values must be absent
+	}{
+		{
+			name:   "chrome",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			want: map[string]string{
+				"Accept-Encoding":           "gzip, deflate",
+				"Upgrade-Insecure-Requests": "1",
+				"Sec-Ch-Ua":                 "",
+				"Sec-Fetch-Site":            "",
+				"Sec-Fetch-Mode":            "",
+				"Priority":                  "",
+				"Cache-Control":             "",
+			},
+		},
+		{
+			name:   "firefox",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}},
+			want: map[string]string{
+				"Accept-Encoding":           "gzip, deflate",
+				"Upgrade-Insecure-Requests": "1",
+				"Sec-Fetch-Site":            "",
+				"Te":                        "",
+			},
+		},
+		{
+			name:   "safari",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari}},
+			want: map[string]string{
+				"Accept-Encoding": "gzip, deflate",
+				"Sec-Fetch-Site":  "",
+				"Priority":        "",
+			},
+		},
+	}
+	target, _ := url.Parse("http://example.com/")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			ImpersonateRequestHeaders(h, test.option, RequestHints{}, http.MethodGet, target)
+			for key, want := range test.want {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRequestHeaderOrder(t *testing.T) {
+	chrome := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		target string
+		want   []string
+	}{
+		{
+			name:   "chrome over https",
+			option: chrome,
+			target: "https://example.com/",
+			want:   GetHeaderOrder(chrome),
+		},
+		{
+			name:   "chrome over http",
+			option: chrome,
+			target: "http://example.com/",
+			want:   []string{"host", "connection", "content-length", "cache-control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "sec-ch-ua-platform-version", "sec-ch-ua-full-version-list", "sec-ch-ua-model", "sec-ch-viewport-width", "sec-ch-dpr", "origin", "content-type", "sec-gpc", "upgrade-insecure-requests", "user-agent", "accept", "x-requested-with", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest", "referer", "accept-encoding", "accept-language", "cookie"},
+		},
+		{
+			name:   "firefox over http",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}},
+			target: "http://example.com/",
+			want:   []string{"host", "user-agent", "accept", "accept-language", "accept-encoding", "content-type", "content-length", "origin", "connection", "referer", "cookie", "upgrade-insecure-requests", "sec-fetch-dest", "sec-fetch-mode", "sec-fetch-site", "sec-fetch-user", "priority"},
+		},
+		{
+			name:   "safari over http",
+			option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 26}},
+			target: "http://example.com/",
+			want:   []string{"host", "sec-fetch-dest", "user-agent", "accept", "content-type", "origin", "sec-fetch-site", "sec-fetch-mode", "upgrade-insecure-requests", "referer", "cache-control", "sec-gpc", "accept-language", "priority", "accept-encoding", "cookie", "content-length", "connection"},
+		},
+		{
+			name:   "okhttp over http",
+			option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp}},
+			target: "http://example.com/",
+			want:   []string{"host", "connection", "accept-encoding", "user-agent"},
+		},
+	}
+	for _, test := range tests {
+		target, err := url.Parse(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := GetRequestHeaderOrder(test.option, target); !slices.Equal(got, test.want) {
+			t.Errorf("%s: GetRequestHeaderOrder() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package browser_impersonate
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// HappyEyeballsFallbackDelay is how long Chromium waits on the first address family before racing the other one.
+const HappyEyeballsFallbackDelay = 300 * time.Millisecond
+
+// HTTPSRecord is a ServiceMode HTTPS DNS record (RFC 9460), the parameters browsers use before connecting.
+type HTTPSRecord struct {
+	Priority      uint16
+	Target        string // "." for the owner name itself
+	ALPN          []string
+	NoDefaultALPN bool
+	Port          uint16
+	IPv4Hint      []netip.Addr
+	IPv6Hint      []netip.Addr
+	ECHConfigList []byte
+}
+
+// Resolver resolves host addresses and HTTPS records, as the resolver of a browser does before connecting.
+// Hosts without HTTPS records return none and no error.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error)
+	LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error)
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func filterNetIP(addrs []netip.Addr, network string) []netip.Addr {
+	filtered := []netip.Addr{}
+	for _, addr := range addrs {
+		switch {
+		case network == "ip4" && !addr.Unmap().Is4(), network == "ip6" && addr.Unmap().Is4():
+			continue
+		}
+		filtered = append(filtered, addr)
+	}
+	return filtered
+}
+
+// StaticResolver answers from fixed records, a local stub for tests. Unknown hosts do not exist.
+type StaticResolver struct {
+	Hosts map[string][]netip.Addr
+	HTTPS map[string][]HTTPSRecord
+}
+
+func (r StaticResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	addrs, ok := r.Hosts[normalizeHost(host)]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return filterNetIP(addrs, network), nil
+}
+
+func (r StaticResolver) LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error) {
+	return r.HTTPS[normalizeHost(host)], nil
+}
+
+// Addresses of ImpersonateOption.Resolve take precedence over the resolver, HTTPS records still come from it.
+type resolveOverrides struct {
+	hosts map[string][]netip.Addr
+	Resolver
+}
+
+func (r resolveOverrides) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	for name, addrs := range r.hosts {
+		if normalizeHost(name) == normalizeHost(host) {
+			return filterNetIP(addrs, network), nil
+		}
+	}
+	return r.Resolver.LookupNetIP(ctx, network, host)
+}
+
+// GetResolver returns the resolver of the persona with the Resolve overrides applied, nil to keep the backend defaults.
+func GetResolver(impersonateOption ImpersonateOption) Resolver {
+	resolver := impersonateOption.Resolver
+	if len(impersonateOption.Resolve) > 0 {
+		if resolver == nil {
+			resolver = NewSystemResolver()
+		}
+		resolver = resolveOverrides{hosts: impersonateOption.Resolve, Resolver: resolver}
+	}
+	return resolver
+}
+
+// GetHTTPSRecord returns the record a browser connects to host with, the usable one with the lowest priority.
+// As in Chromium, only records of the host itself are used, AliasMode and other targets are ignored.
+// Lookup errors are ignored too, the connection goes on without the record.
+func GetHTTPSRecord(ctx context.Context, resolver Resolver, host string) (HTTPSRecord, bool) {
+	records, err := resolver.LookupHTTPS(ctx, host)
+	if err != nil {
+		return HTTPSRecord{}, false
+	}
+	usable := []HTTPSRecord{}
+	for _, record := range records {
+		if record.Priority == 0 || (record.Target != "." && record.Target != "" && normalizeHost(record.Target) != normalizeHost(host)) {
+			continue
+		}
+		usable = append(usable, record)
+	}
+	if len(usable) == 0 {
+		return HTTPSRecord{}, false
+	}
+	slices.SortStableFunc(usable, func(a HTTPSRecord, b HTTPSRecord) int {
+		return int(a.Priority) - int(b.Priority)
+	})
+	return usable[0], true
+}
+
+// HTTPSRecordECHConfigs looks up ECH configs in the HTTPS records of the resolver.
+type HTTPSRecordECHConfigs struct {
+	Resolver Resolver
+}
+
+func (e HTTPSRecordECHConfigs) LookupECHConfigList(ctx context.Context, host string) ([]byte, error) {
+	record, _ := GetHTTPSRecord(ctx, e.Resolver, host)
+	return record.ECHConfigList, nil
+}
+
+// NewNetResolver returns a net.Resolver answering from resolver, so a net.Dialer using it connects to its addresses
+// and races IPv6 and IPv4 with Happy Eyeballs. The hosts file is still read first, as browsers do.
+func NewNetResolver(resolver Resolver) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return &resolverConn{ctx: ctx, resolver: resolver}, nil
+		},
+	}
+}
+
+// GetDialer returns the dialer connecting through the resolver of the persona with its TCP profile,
+// false when the backend default dialer does the same.
+func GetDialer(impersonateOption ImpersonateOption) (net.Dialer, bool) {
+	dialer := net.Dialer{Control: GetTCPControl(impersonateOption)}
+	if resolver := GetResolver(impersonateOption); resolver != nil {
+		dialer.Resolver = NewNetResolver(resolver)
+		dialer.FallbackDelay = HappyEyeballsFallbackDelay
+	}
+	return dialer, dialer.Resolver != nil || dialer.Control != nil
+}
+
+// resolverConn is the DNS server net.Resolver talks to, answering A and AAAA queries from a Resolver.
+// It is not a net.PacketConn, so messages are framed with their length as over TCP.
+type resolverConn struct {
+	ctx      context.Context
+	resolver Resolver
+	mu       sync.Mutex
+	response []byte
+}
+
+func (c *resolverConn) Write(b []byte) (int, error) {
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		return 0, errors.New("resolver: short DNS query")
+	}
+	response, err := answerDNSQuery(c.ctx, c.resolver, b[2:])
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.response = append(c.response, binary.BigEndian.AppendUint16(nil, uint16(len(response)))...)
+	c.response = append(c.response, response...)
+	c.mu.Unlock()
+	return len(b), nil
+}
+
+func (c *resolverConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.response) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.response)
+	c.response = c.response[n:]
+	return n, nil
+}
+
+func (c *resolverConn) Close() error                       { return nil }
+func (c *resolverConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *resolverConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *resolverConn) SetDeadline(t time.Time) error      { return nil }
+func (c *resolverConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *resolverConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func answerDNSQuery(ctx context.Context, resolver Resolver, query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionDesired: header.RecursionDesired, RecursionAvailable: true})
+	builder.EnableCompression()
+	var addrs []netip.Addr
+	switch question.Type {
+	case dnsmessage.TypeA:
+		addrs, err = resolver.LookupNetIP(ctx, "ip4", question.Name.String())
+	case dnsmessage.TypeAAAA:
+		addrs, err = resolver.LookupNetIP(ctx, "ip6", question.Name.String())
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		builder = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeNameError})
+	case err != nil:
+		builder = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeServerFailure})
+	}
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	resourceHeader := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		switch {
+		case question.Type == dnsmessage.TypeA && addr.Is4():
+			err = builder.AResource(resourceHeader, dnsmessage.AResource{A: addr.As4()})
+		case question.Type == dnsmessage.TypeAAAA && addr.Is6():
+			err = builder.AAAAResource(resourceHeader, dnsmessage.AAAAResource{AAAA: addr.As16()})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
@@ -0,0 +1,356 @@
+package browser_impersonate
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// How long answers without records and failed HTTPS lookups are cached, as they carry no TTL of their own here.
+const dnsNegativeCacheTTL = time.Minute
+
+// dnsExchange sends a DNS query and returns the response.
+type dnsExchange func(ctx context.Context, query []byte) ([]byte, error)
+
+// dnsCache keeps the parsed answers of queries until their TTL runs out.
+type dnsCache struct {
+	mu      sync.Mutex
+	answers map[dnsmessage.Question]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	resources []dnsmessage.Resource
+	err       error
+	expires   time.Time
+}
+
+func (c *dnsCache) store(question dnsmessage.Question, entry dnsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.answers == nil {
+		c.answers = map[dnsmessage.Question]dnsCacheEntry{}
+	}
+	c.answers[question] = entry
+}
+
+func (c *dnsCache) lookup(ctx context.Context, exchange dnsExchange, host string, queryType dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	name, err := dnsmessage.NewName(normalizeHost(host) + ".")
+	if err != nil {
+		return nil, err
+	}
+	question := dnsmessage.Question{Name: name, Type: queryType, Class: dnsmessage.ClassINET}
+	c.mu.Lock()
+	entry, ok := c.answers[question]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.resources, entry.err
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	// Room for ECH configs in HTTPS records
+	if err := builder.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(1232, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+	response, err := exchange(ctx, query)
+	if err != nil {
+		if queryType == dnsmessage.TypeHTTPS {
+			// Connections go on without the record, they should not wait on the resolver each time
+			c.store(question, dnsCacheEntry{err: err, expires: time.Now().Add(dnsNegativeCacheTTL)})
+		}
+		return nil, err
+	}
+
+	var message dnsmessage.Message
+	if err := message.Unpack(response); err != nil {
+		return nil, err
+	}
+	// Resolvers may change the case of the name, as in DNS 0x20
+	if !message.Response || len(message.Questions) != 1 || message.Questions[0].Type != queryType || message.Questions[0].Class != question.Class ||
+		!strings.EqualFold(message.Questions[0].Name.String(), question.Name.String()) {
+		return nil, &net.DNSError{Err: "response to another question", Name: host, IsTemporary: true}
+	}
+	switch message.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		err := &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		c.store(question, dnsCacheEntry{err: err, expires: time.Now().Add(dnsNegativeCacheTTL)})
+		return nil, err
+	default:
+		return nil, &net.DNSError{Err: "server misbehaving: " + message.RCode.String(), Name: host, IsTemporary: true}
+	}
+	resources := []dnsmessage.Resource{}
+	ttl := dnsNegativeCacheTTL
+	for _, resource := range message.Answers {
+		if resource.Header.Type != queryType {
+			continue
+		}
+		resources = append(resources, resource)
+		ttl = min(ttl, time.Duration(resource.Header.TTL)*time.Second)
+	}
+	c.store(question, dnsCacheEntry{resources: resources, expires: time.Now().Add(ttl)})
+	return resources, nil
+}
+
+func (c *dnsCache) lookupNetIP(ctx context.Context, exchange dnsExchange, network string, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return filterNetIP([]netip.Addr{addr}, network), nil
+	}
+	queryTypes := []dnsmessage.Type{dnsmessage.TypeAAAA, dnsmessage.TypeA}
+	switch network {
+	case "ip4":
+		queryTypes = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		queryTypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	}
+	addrs := []netip.Addr{}
+	var lastErr error
+	for _, queryType := range queryTypes {
+		resources, err := c.lookup(ctx, exchange, host, queryType)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, resource := range resources {
+			switch body := resource.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, netip.AddrFrom4(body.A))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+			}
+		}
+	}
+	if len(addrs) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return addrs, nil
+}
+
+func (c *dnsCache) lookupHTTPS(ctx context.Context, exchange dnsExchange, host string) ([]HTTPSRecord, error) {
+	resources, err := c.lookup(ctx, exchange, host, dnsmessage.TypeHTTPS)
+	if err != nil {
+		return nil, err
+	}
+	records := []HTTPSRecord{}
+	for _, resource := range resources {
+		if body, ok := resource.Body.(*dnsmessage.HTTPSResource); ok {
+			records = append(records, parseHTTPSRecord(body))
+		}
+	}
+	return records, nil
+}
+
+func parseHTTPSRecord(resource *dnsmessage.HTTPSResource) HTTPSRecord {
+	record := HTTPSRecord{Priority: resource.Priority, Target: resource.Target.String()}
+	for _, param := range resource.Params {
+		value := param.Value
+		switch param.Key {
+		case dnsmessage.SVCParamALPN:
+			for len(value) > 0 && len(value) > int(value[0]) {
+				record.ALPN = append(record.ALPN, string(value[1:1+int(value[0])]))
+				value = value[1+int(value[0]):]
+			}
+		case dnsmessage.SVCParamNoDefaultALPN:
+			record.NoDefaultALPN = true
+		case dnsmessage.SVCParamPort:
+			if len(value) == 2 {
+				record.Port = binary.BigEndian.Uint16(value)
+			}
+		case dnsmessage.SVCParamIPv4Hint:
+			for ; len(value) >= 4; value = value[4:] {
+				record.IPv4Hint = append(record.IPv4Hint, netip.AddrFrom4([4]byte(value[:4])))
+			}
+		case dnsmessage.SVCParamECH:
+			record.ECHConfigList = value
+		case dnsmessage.SVCParamIPv6Hint:
+			for ; len(value) >= 16; value = value[16:] {
+				record.IPv6Hint = append(record.IPv6Hint, netip.AddrFrom16([16]byte(value[:16])))
+			}
+		}
+	}
+	return record
+}
+
+// SystemResolver resolves addresses with the OS, and HTTPS records by querying the nameservers of /etc/resolv.conf,
+// as Chromium's built-in resolver does on Linux. macOS keeps the file up to date too,
+// HTTPS lookups fail on Windows which has none, connections then go on without the records.
+type SystemResolver struct {
+	cache dnsCache
+}
+
+func NewSystemResolver() *SystemResolver {
+	return &SystemResolver{}
+}
+
+func (r *SystemResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, network, host)
+}
+
+func (r *SystemResolver) LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error) {
+	return r.cache.lookupHTTPS(ctx, r.exchange, host)
+}
+
+func (r *SystemResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	nameservers, err := systemNameservers()
+	if err != nil {
+		return nil, err
+	}
+	// A random ID, so spoofed UDP answers have to guess it
+	query = slices.Clone(query)
+	binary.BigEndian.PutUint16(query, uint16(rand.Uint32()))
+	var lastErr error
+	for _, nameserver := range nameservers {
+		response, err := exchangeDNS(ctx, "udp", nameserver, query)
+		if err == nil && len(response) > 2 && response[2]&0x02 != 0 {
+			// Truncated, retry over TCP
+			response, err = exchangeDNS(ctx, "tcp", nameserver, query)
+		}
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func systemNameservers() ([]string, error) {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("resolver: no nameservers to look up HTTPS records with: %w", err)
+	}
+	nameservers := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "nameserver" {
+			nameservers = append(nameservers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(nameservers) == 0 {
+		// The libc default when the file lists none
+		nameservers = []string{"127.0.0.1:53", "[::1]:53"}
+	}
+	return nameservers, nil
+}
+
+func exchangeDNS(ctx context.Context, network string, address string, query []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		response := make([]byte, 65535)
+		for {
+			n, err := conn.Read(response)
+			if err != nil {
+				return nil, err
+			}
+			// Answers with another ID are not for this query, the right one may still come
+			if n >= 2 && bytes.Equal(response[:2], query[:2]) {
+				return response[:n], nil
+			}
+		}
+	}
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+		return nil, err
+	}
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	if len(response) < 2 || !bytes.Equal(response[:2], query[:2]) {
+		return nil, errors.New("resolver: DNS response to another query")
+	}
+	return response, nil
+}
+
+// DoHResolver resolves over DNS over HTTPS (RFC 8484), as browsers do with secure DNS enabled.
+// The DoH server sees the TLS fingerprint of Client, Go's one for a plain http.Client: there is no default client.
+type DoHResolver struct {
+	URL    string       // Template without variables, "https://cloudflare-dns.com/dns-query"
+	Client *http.Client // Sends the queries, required
+	cache  dnsCache
+}
+
+func NewDoHResolver(url string, client *http.Client) *DoHResolver {
+	return &DoHResolver{URL: url, Client: client}
+}
+
+func (r *DoHResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	return r.cache.lookupNetIP(ctx, r.exchange, network, host)
+}
+
+func (r *DoHResolver) LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error) {
+	return r.cache.lookupHTTPS(ctx, r.exchange, host)
+}
+
+func (r *DoHResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if r.Client == nil {
+		return nil, errors.New("doh: no Client to send the queries with")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: %s answered %s", r.URL, resp.Status)
+	}
+	response, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	if len(response) == 0 {
+		return nil, errors.New("doh: empty response")
+	}
+	return response, nil
+}
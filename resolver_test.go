@@ -0,0 +1,163 @@
+package browser_impersonate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver failing every lookup, for SERVFAIL answers.
+type failingResolver struct{ StaticResolver }
+
+func (failingResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	return nil, errors.New("lookup failed")
+}
+
+func newDNSQuery(t *testing.T, id uint16, name string, queryType dnsmessage.Type) []byte {
+	t.Helper()
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := builder.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: queryType, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestAnswerDNSQuery(t *testing.T) {
+	resolver := StaticResolver{Hosts: map[string][]netip.Addr{
+		"example.com": {netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")},
+	}}
+	tests := []struct {
+		name      string
+		resolver  Resolver
+		host      string
+		queryType dnsmessage.Type
+		rcode     dnsmessage.RCode
+		answers   []dnsmessage.ResourceBody
+	}{
+		{name: "A", resolver: resolver, host: "example.com.", queryType: dnsmessage.TypeA, answers: []dnsmessage.ResourceBody{&dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}}},
+		{name: "AAAA", resolver: resolver, host: "Example.com.", queryType: dnsmessage.TypeAAAA, answers: []dnsmessage.ResourceBody{&dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()}}},
+		{name: "unknown host", resolver: resolver, host: "unknown.example.", queryType: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError},
+		{name: "lookup error", resolver: failingResolver{}, host: "example.com.", queryType: dnsmessage.TypeA, rcode: dnsmessage.RCodeServerFailure},
+		{name: "other types have no answer", resolver: resolver, host: "example.com.", queryType: dnsmessage.TypeMX},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := answerDNSQuery(context.Background(), test.resolver, newDNSQuery(t, 0x1234, test.host, test.queryType))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var message dnsmessage.Message
+			if err := message.Unpack(response); err != nil {
+				t.Fatal(err)
+			}
+			if message.ID != 0x1234 || !message.Response || message.RCode != test.rcode {
+				t.Fatalf("got ID %#x, response %v and %v, want %#x, true and %v", message.ID, message.Response, message.RCode, 0x1234, test.rcode)
+			}
+			if len(message.Questions) != 1 || message.Questions[0].Name.String() != test.host {
+				t.Fatalf("got questions %v", message.Questions)
+			}
+			answers := []dnsmessage.ResourceBody{}
+			for _, answer := range message.Answers {
+				answers = append(answers, answer.Body)
+			}
+			if len(answers) != len(test.answers) || len(answers) > 0 && !reflect.DeepEqual(answers, test.answers) {
+				t.Fatalf("got answers %v, want %v", answers, test.answers)
+			}
+		})
+	}
+}
+
+func TestParseHTTPSRecord(t *testing.T) {
+	resource := &dnsmessage.HTTPSResource{SVCBResource: dnsmessage.SVCBResource{
+		Priority: 1,
+		Target:   dnsmessage.MustNewName("."),
+		Params: []dnsmessage.SVCParam{
+			{Key: dnsmessage.SVCParamALPN, Value: []byte("\x02h3\x02h2")},
+			{Key: dnsmessage.SVCParamNoDefaultALPN},
+			{Key: dnsmessage.SVCParamPort, Value: []byte{0x20, 0xfb}},
+			{Key: dnsmessage.SVCParamIPv4Hint, Value: []byte{192, 0, 2, 1, 192, 0, 2, 2}},
+			{Key: dnsmessage.SVCParamECH, Value: []byte{0x00, 0x01, 0xff}},
+			{Key: dnsmessage.SVCParamIPv6Hint, Value: netip.MustParseAddr("2001:db8::1").AsSlice()},
+		},
+	}}
+	want := HTTPSRecord{
+		Priority:      1,
+		Target:        ".",
+		ALPN:          []string{"h3", "h2"},
+		NoDefaultALPN: true,
+		Port:          8443,
+		IPv4Hint:      []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")},
+		IPv6Hint:      []netip.Addr{netip.MustParseAddr("2001:db8::1")},
+		ECHConfigList: []byte{0x00, 0x01, 0xff},
+	}
+	if got := parseHTTPSRecord(resource); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// A truncated ALPN value keeps the protocols before it
+	resource.Params = []dnsmessage.SVCParam{{Key: dnsmessage.SVCParamALPN, Value: []byte("\x02h2\x05h")}}
+	if got := parseHTTPSRecord(resource); !reflect.DeepEqual(got.ALPN, []string{"h2"}) {
+		t.Fatalf("got ALPN %v from a truncated value", got.ALPN)
+	}
+}
+
+func TestDNSCacheRejectsOtherQuestions(t *testing.T) {
+	var cache dnsCache
+	exchange := func(ctx context.Context, query []byte) ([]byte, error) {
+		return answerDNSQuery(ctx, StaticResolver{Hosts: map[string][]netip.Addr{"other.example": {netip.MustParseAddr("192.0.2.1")}}}, newDNSQuery(t, 0, "other.example.", dnsmessage.TypeA))
+	}
+	_, err := cache.lookupNetIP(context.Background(), exchange, "ip4", "example.com")
+	if dnsErr := (*net.DNSError)(nil); !errors.As(err, &dnsErr) || dnsErr.Err != "response to another question" {
+		t.Fatalf("got %v for the answer to another name", err)
+	}
+}
+
+func TestExchangeDNSSkipsOtherIDs(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go func() {
+		query := make([]byte, 512)
+		n, client, err := server.ReadFrom(query)
+		if err != nil {
+			return
+		}
+		// A spoofed answer first, then the real one
+		spoofed, _ := answerDNSQuery(context.Background(), StaticResolver{Hosts: map[string][]netip.Addr{"example.com": {netip.MustParseAddr("203.0.113.1")}}}, query[:n])
+		spoofed[0] ^= 0xff
+		server.WriteTo(spoofed, client)
+		answer, _ := answerDNSQuery(context.Background(), StaticResolver{Hosts: map[string][]netip.Addr{"example.com": {netip.MustParseAddr("192.0.2.1")}}}, query[:n])
+		server.WriteTo(answer, client)
+	}()
+	response, err := exchangeDNS(context.Background(), "udp", server.LocalAddr().String(), newDNSQuery(t, 0x4242, "example.com.", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message dnsmessage.Message
+	if err := message.Unpack(response); err != nil {
+		t.Fatal(err)
+	}
+	if message.ID != 0x4242 || len(message.Answers) != 1 || message.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{192, 0, 2, 1} {
+		t.Fatalf("got %+v", message)
+	}
+}
+
+func TestDoHResolverRequiresClient(t *testing.T) {
+	if _, err := NewDoHResolver("https://dns.example/dns-query", nil).LookupHTTPS(context.Background(), "example.com"); err == nil {
+		t.Fatal("lookup without a client succeeded")
+	}
+}
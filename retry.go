@@ -0,0 +1,245 @@
+package browser_impersonate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How much of a response body the retry matchers look at, challenge pages give themselves away early.
+const retryBodyPeekSize = 16 << 10
+
+// RetryReason says why an attempt was retried.
+type RetryReason string
+
+const (
+	RetryReasonError       RetryReason = "error"
+	RetryReasonBlocked     RetryReason = "blocked"
+	RetryReasonRateLimited RetryReason = "rate-limited"
+	RetryReasonChallenge   RetryReason = "challenge"
+	RetryReasonUnavailable RetryReason = "unavailable"
+)
+
+// RetryResponse is what the retry matchers see of a response, with the first bytes of its body.
+type RetryResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// RetryMatcher classifies the result of an attempt, the response is empty when it failed with err.
+// It returns the reason to retry for, false to let the result through.
+type RetryMatcher func(response RetryResponse, err error) (RetryReason, bool)
+
+// MatchError retries the attempts failing with an error, requests canceled by the caller aside.
+func MatchError(reason RetryReason) RetryMatcher {
+	return func(response RetryResponse, err error) (RetryReason, bool) {
+		return reason, err != nil && !errors.Is(err, context.Canceled)
+	}
+}
+
+// MatchStatus retries the responses with one of the status codes.
+func MatchStatus(reason RetryReason, statusCodes ...int) RetryMatcher {
+	return func(response RetryResponse, err error) (RetryReason, bool) {
+		for _, statusCode := range statusCodes {
+			if err == nil && response.StatusCode == statusCode {
+				return reason, true
+			}
+		}
+		return reason, false
+	}
+}
+
+// MatchHeader retries the responses with a header of the value, compared without case.
+func MatchHeader(reason RetryReason, name string, value string) RetryMatcher {
+	return func(response RetryResponse, err error) (RetryReason, bool) {
+		for _, v := range response.Header.Values(name) {
+			if strings.EqualFold(v, value) {
+				return reason, true
+			}
+		}
+		return reason, false
+	}
+}
+
+// MatchBody retries the responses with one of the markers in the first bytes of their body.
+func MatchBody(reason RetryReason, markers ...string) RetryMatcher {
+	return func(response RetryResponse, err error) (RetryReason, bool) {
+		for _, marker := range markers {
+			if bytes.Contains(response.Body, []byte(marker)) {
+				return reason, true
+			}
+		}
+		return reason, false
+	}
+}
+
+// DefaultRetryMatchers retry errors, the challenge pages of the common bot protections, 429, 403 and 503.
+var DefaultRetryMatchers = []RetryMatcher{
+	MatchError(RetryReasonError),
+	MatchHeader(RetryReasonChallenge, "cf-mitigated", "challenge"),
+	// Cloudflare, DataDome, Imperva and PerimeterX
+	MatchBody(RetryReasonChallenge, "<title>Just a moment...</title>", "geo.captcha-delivery.com", "/_Incapsula_Resource", "px-captcha"),
+	MatchStatus(RetryReasonRateLimited, http.StatusTooManyRequests),
+	MatchStatus(RetryReasonBlocked, http.StatusForbidden),
+	MatchStatus(RetryReasonUnavailable, http.StatusServiceUnavailable),
+}
+
+// RetryOptions configure the retries of DoTLSClientWithRetry and DoAzureTLSWithRetry.
+type RetryOptions struct {
+	MaxAttempts   int            // Attempts in all, the first one included, 3 when 0
+	Matchers      []RetryMatcher // DefaultRetryMatchers when nil, the first one matching gives the reason
+	BaseDelay     time.Duration  // Delay before the second attempt, doubled for each next one, 1 second when 0
+	MaxDelay      time.Duration  // Cap of the delays, Retry-After included, 1 minute when 0
+	RotatePersona bool           // Retry with a new session of the pool of the lease, so with a new persona
+	RotateProxy   bool           // Move the persona to another proxy of its ProxyPool before retrying
+	OnRetry       func(attempt RetryAttempt)
+}
+
+// RetryAttempt records an attempt that was retried and why.
+type RetryAttempt struct {
+	Attempt    int // 1 for the first request
+	Reason     RetryReason
+	StatusCode int // 0 when the attempt failed with Err
+	Err        error
+	Delay      time.Duration // Waited before the next attempt
+	NewPersona bool          // The next attempt used a new session with a persona of its own
+	NewProxy   bool          // The next attempt went through another proxy
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = 3
+	}
+	if o.Matchers == nil {
+		o.Matchers = DefaultRetryMatchers
+	}
+	if o.BaseDelay == 0 {
+		o.BaseDelay = time.Second
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = time.Minute
+	}
+	return o
+}
+
+func (o RetryOptions) classify(response RetryResponse, err error) (RetryReason, bool) {
+	for _, matcher := range o.Matchers {
+		if reason, ok := matcher(response, err); ok {
+			return reason, true
+		}
+	}
+	return "", false
+}
+
+// delay returns the wait after the attempt, exponential with equal jitter, or Retry-After when the server asked for more.
+func (o RetryOptions) delay(attempt int, header http.Header) time.Duration {
+	backoff := min(o.BaseDelay<<(attempt-1), o.MaxDelay)
+	if backoff <= 0 {
+		// Shifted past the range of Duration
+		backoff = o.MaxDelay
+	}
+	delay := backoff/2 + rand.N(backoff/2+1)
+	if retryAfter := parseRetryAfter(header.Get("Retry-After")); retryAfter > delay {
+		delay = min(retryAfter, o.MaxDelay)
+	}
+	return delay
+}
+
+// parseRetryAfter reads the delay in seconds or the HTTP date of a Retry-After header, 0 when it has none.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// waitRetry waits for the delay, unless ctx is done first.
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// peekedBody is a response body read again from the start, once the matchers looked at its first bytes.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// retryBackend moves the sessions of a backend to another proxy.
+type retryBackend[S any] interface {
+	proxy(session S) string
+	setProxy(session S, proxyURL string) error
+	proxySchemes() []string
+}
+
+// leaseRetryBackend returns the backend of the pool of the lease, fallback for leases without pool.
+func leaseRetryBackend[S any](lease *SessionLease[S], fallback retryBackend[S]) retryBackend[S] {
+	if lease.pool != nil {
+		if backend, ok := lease.pool.backend.(retryBackend[S]); ok {
+			return backend
+		}
+	}
+	return fallback
+}
+
+// doWithRetry sends attempts with the session of the lease until one is let through by the matchers or they run out,
+// the response of an attempt being retried is discarded. It returns the lease of the last attempt, nil when renewing failed.
+func doWithRetry[S any, R any](ctx context.Context, options RetryOptions, lease *SessionLease[S], backend retryBackend[S], send func(session S) (R, RetryResponse, error), discard func(R)) (R, *SessionLease[S], []RetryAttempt, error) {
+	options = options.withDefaults()
+	attempts := []RetryAttempt{}
+	for n := 1; ; n++ {
+		proxyURL := backend.proxy(lease.Session)
+		result, response, err := send(lease.Session)
+		reason, retry := options.classify(response, err)
+		if !retry || n >= options.MaxAttempts {
+			return result, lease, attempts, err
+		}
+		discard(result)
+		attempt := RetryAttempt{Attempt: n, Reason: reason, StatusCode: response.StatusCode, Err: err, Delay: options.delay(n, response.Header)}
+		if options.RotatePersona && lease.pool != nil {
+			next, err := lease.Renew(ctx)
+			if err != nil {
+				var zero R
+				return zero, nil, attempts, err
+			}
+			lease = next
+			attempt.NewPersona = true
+		} else if pool := lease.Persona.ProxyPool; options.RotateProxy && pool != nil && backend.proxy(lease.Session) == proxyURL {
+			// The pool did not move the persona already on this result
+			if next, err := pool.Rotate(lease.Persona.ProxyKey, backend.proxySchemes()...); err == nil && next != proxyURL {
+				if err := backend.setProxy(lease.Session, next); err != nil {
+					var zero R
+					return zero, lease, attempts, err
+				}
+			}
+		}
+		attempt.NewProxy = backend.proxy(lease.Session) != proxyURL
+		if options.OnRetry != nil {
+			options.OnRetry(attempt)
+		}
+		attempts = append(attempts, attempt)
+		if err := waitRetry(ctx, attempt.Delay); err != nil {
+			var zero R
+			return zero, lease, attempts, err
+		}
+	}
+}
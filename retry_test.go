@@ -0,0 +1,230 @@
+package browser_impersonate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{value: ""},
+		{value: "5", min: 5 * time.Second, max: 5 * time.Second},
+		{value: "0"},
+		{value: "-3"},
+		{value: "soon"},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value); got < test.min || got > test.max {
+			t.Errorf("%q: got %v, want between %v and %v", test.value, got, test.min, test.max)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	options := RetryOptions{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}.withDefaults()
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{name: "first", attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "third", attempt: 3, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{name: "capped", attempt: 10, min: time.Second, max: 2 * time.Second},
+		{name: "shifted past Duration", attempt: 100, min: time.Second, max: 2 * time.Second},
+		{name: "Retry-After longer", attempt: 1, retryAfter: "1", min: time.Second, max: time.Second},
+		{name: "Retry-After capped", attempt: 1, retryAfter: "3600", min: 2 * time.Second, max: 2 * time.Second},
+		{name: "Retry-After shorter", attempt: 3, retryAfter: "0", min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if test.retryAfter != "" {
+				header.Set("Retry-After", test.retryAfter)
+			}
+			for range 20 {
+				if delay := options.delay(test.attempt, header); delay < test.min || delay > test.max {
+					t.Fatalf("got %v, want between %v and %v", delay, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+// Result of an attempt sent by a test of doWithRetry.
+type fakeRetryResult struct {
+	statusCode int
+	err        error
+}
+
+func TestDoWithRetry(t *testing.T) {
+	ok := fakeRetryResult{statusCode: http.StatusOK}
+	tests := []struct {
+		name     string
+		options  RetryOptions
+		results  []fakeRetryResult
+		sent     int
+		reasons  []RetryReason
+		response fakeRetryResult
+	}{
+		{name: "let through", results: []fakeRetryResult{ok}, sent: 1, response: ok},
+		{name: "not matched", results: []fakeRetryResult{{statusCode: http.StatusNotFound}}, sent: 1, response: fakeRetryResult{statusCode: http.StatusNotFound}},
+		{
+			name:     "rate limited",
+			results:  []fakeRetryResult{{statusCode: http.StatusTooManyRequests}, ok},
+			sent:     2,
+			reasons:  []RetryReason{RetryReasonRateLimited},
+			response: ok,
+		},
+		{
+			name:     "error",
+			results:  []fakeRetryResult{{err: errors.New("connection reset")}, {statusCode: http.StatusServiceUnavailable}, ok},
+			sent:     3,
+			reasons:  []RetryReason{RetryReasonError, RetryReasonUnavailable},
+			response: ok,
+		},
+		{
+			name:     "canceled",
+			results:  []fakeRetryResult{{err: context.Canceled}},
+			sent:     1,
+			response: fakeRetryResult{err: context.Canceled},
+		},
+		{
+			name:     "attempts run out",
+			options:  RetryOptions{MaxAttempts: 2},
+			results:  []fakeRetryResult{{statusCode: http.StatusForbidden}, {statusCode: http.StatusForbidden}, ok},
+			sent:     2,
+			reasons:  []RetryReason{RetryReasonBlocked},
+			response: fakeRetryResult{statusCode: http.StatusForbidden},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, backend := newFakeSessionPool(t, nil, SessionPoolOptions{})
+			lease := leaseFakeSession(t, pool)
+			sent, discarded := 0, 0
+			send := func(session *fakeSession) (int, RetryResponse, error) {
+				result := test.results[sent]
+				sent++
+				return sent, RetryResponse{StatusCode: result.statusCode}, result.err
+			}
+			reasons := []RetryReason{}
+			options := test.options
+			options.BaseDelay, options.MaxDelay = time.Nanosecond, time.Millisecond
+			options.OnRetry = func(attempt RetryAttempt) { reasons = append(reasons, attempt.Reason) }
+			result, last, attempts, err := doWithRetry(context.Background(), options, lease, backend, send, func(int) { discarded++ })
+			if sent != test.sent || result != sent || discarded != sent-1 {
+				t.Fatalf("got result %d of %d sent, %d discarded, want %d sent", result, sent, discarded, test.sent)
+			}
+			if response := test.results[sent-1]; response != test.response || err != response.err {
+				t.Fatalf("got %+v, %v, want %+v", response, err, test.response)
+			}
+			if len(attempts) != len(test.reasons) || len(reasons) != len(test.reasons) {
+				t.Fatalf("got attempts %+v, want %v", attempts, test.reasons)
+			}
+			for i, attempt := range attempts {
+				if attempt.Attempt != i+1 || attempt.Reason != test.reasons[i] || reasons[i] != test.reasons[i] || attempt.NewPersona || attempt.NewProxy {
+					t.Fatalf("got attempt %+v, want reason %v", attempt, test.reasons[i])
+				}
+			}
+			if last != lease {
+				t.Fatal("got another lease without RotatePersona")
+			}
+		})
+	}
+}
+
+func TestDoWithRetryRotatePersona(t *testing.T) {
+	pool, backend := newFakeSessionPool(t, nil, SessionPoolOptions{})
+	lease := leaseFakeSession(t, pool)
+	sessions := []*fakeSession{}
+	send := func(session *fakeSession) (int, RetryResponse, error) {
+		sessions = append(sessions, session)
+		if len(sessions) == 1 {
+			return 0, RetryResponse{StatusCode: http.StatusForbidden}, nil
+		}
+		return 0, RetryResponse{StatusCode: http.StatusOK}, nil
+	}
+	options := RetryOptions{BaseDelay: time.Nanosecond, MaxDelay: time.Millisecond, RotatePersona: true}
+	_, last, attempts, err := doWithRetry(context.Background(), options, lease, backend, send, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0] == sessions[1] || sessions[1] != last.Session || last == lease {
+		t.Fatal("want the second attempt sent with the session of a new lease")
+	}
+	if len(attempts) != 1 || !attempts[0].NewPersona || sessions[0].closed.Load() != 1 {
+		t.Fatalf("got %+v, want the first session retired", attempts)
+	}
+	// The caller hands back the lease returned, the renewed one is over
+	lease.Release()
+	last.Release()
+	if stats := pool.Stats(); stats != (SessionPoolStats{Idle: 1, Created: 2, Retired: 1}) {
+		t.Fatalf("got %+v", stats)
+	}
+
+	// The lease is over when renewing fails
+	errNoPersona := errors.New("no persona")
+	generated := false
+	pool, backend = newFakeSessionPool(t, func() (ImpersonateOption, error) {
+		if generated {
+			return ImpersonateOption{}, errNoPersona
+		}
+		generated = true
+		return ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}, nil
+	}, SessionPoolOptions{})
+	sessions = nil
+	if _, last, _, err := doWithRetry(context.Background(), options, leaseFakeSession(t, pool), backend, send, func(int) {}); !errors.Is(err, errNoPersona) || last != nil {
+		t.Fatalf("got %v, %v, want the generator error and no lease", last, err)
+	}
+	if stats := pool.Stats(); stats != (SessionPoolStats{Created: 1, Retired: 1}) {
+		t.Fatalf("got %+v", stats)
+	}
+}
+
+func TestDoWithRetryRotateProxy(t *testing.T) {
+	const first, second = "http://a.example:8080", "http://b.example:8080"
+	proxyPool := newTestProxyPool(t, []string{first, second}, ProxyPoolOptions{})
+	generator := func() (ImpersonateOption, error) {
+		return ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, ProxyPool: proxyPool, ProxyKey: "persona"}, nil
+	}
+	pool, backend := newFakeSessionPool(t, generator, SessionPoolOptions{})
+	lease := leaseFakeSession(t, pool)
+	proxies := []string{}
+	send := func(session *fakeSession) (int, RetryResponse, error) {
+		proxies = append(proxies, backend.proxy(session))
+		return 0, RetryResponse{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"0"}}}, nil
+	}
+	options := RetryOptions{MaxAttempts: 2, BaseDelay: time.Nanosecond, MaxDelay: time.Millisecond, RotateProxy: true}
+	_, last, attempts, err := doWithRetry(context.Background(), options, lease, backend, send, func(int) {})
+	if err != nil || last != lease {
+		t.Fatal(err)
+	}
+	if len(proxies) != 2 || proxies[0] != first || proxies[1] != second || len(attempts) != 1 || !attempts[0].NewProxy {
+		t.Fatalf("got proxies %v and attempts %+v, want the second attempt through %q", proxies, attempts, second)
+	}
+}
+
+func TestDoWithRetryStopsWithContext(t *testing.T) {
+	pool, backend := newFakeSessionPool(t, nil, SessionPoolOptions{})
+	lease := leaseFakeSession(t, pool)
+	ctx, cancel := context.WithCancel(context.Background())
+	sent := 0
+	send := func(session *fakeSession) (int, RetryResponse, error) {
+		sent++
+		cancel()
+		return 0, RetryResponse{StatusCode: http.StatusServiceUnavailable}, nil
+	}
+	options := RetryOptions{BaseDelay: time.Hour, MaxDelay: time.Hour}
+	if _, _, attempts, err := doWithRetry(ctx, options, lease, backend, send, func(int) {}); !errors.Is(err, context.Canceled) || sent != 1 || len(attempts) != 1 {
+		t.Fatalf("got %v after %d attempts, want context.Canceled after the first", err, sent)
+	}
+}
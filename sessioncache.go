@@ -0,0 +1,137 @@
+package browser_impersonate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Chromium keeps the sessions of up to 1024 servers in its SSLClientSessionCache.
+const DefaultTLSSessionStoreCapacity = 1024
+
+// TLSSessionTicket is a session ticket with the resumption state it unlocks, as the utls forks serialize them.
+// Only azuretls resumes from the store, tls-client keeps a session cache of its own per client.
+type TLSSessionTicket struct {
+	Ticket []byte `json:"ticket"`
+	State  []byte `json:"state"`
+}
+
+// TLSSessionStore holds the session tickets of a persona, keyed by server name like the TLS session caches.
+// A persona keeps its own store: sharing one between personas links them to the servers through the tickets.
+type TLSSessionStore struct {
+	mu       sync.Mutex
+	capacity int
+	tickets  map[string]TLSSessionTicket
+	lastUsed map[string]uint64
+	clock    uint64
+}
+
+// NewTLSSessionStore returns an empty store keeping the tickets of up to DefaultTLSSessionStoreCapacity servers.
+func NewTLSSessionStore() *TLSSessionStore {
+	return &TLSSessionStore{
+		capacity: DefaultTLSSessionStoreCapacity,
+		tickets:  map[string]TLSSessionTicket{},
+		lastUsed: map[string]uint64{},
+	}
+}
+
+// LoadTLSSessionStore returns a store with the tickets saved at path, an empty one if nothing was saved there yet.
+// Expired tickets are loaded too, the TLS stacks skip them when resuming.
+func LoadTLSSessionStore(path string) (*TLSSessionStore, error) {
+	store := NewTLSSessionStore()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.tickets); err != nil {
+		return nil, err
+	}
+	for key := range store.tickets {
+		store.clock++
+		store.lastUsed[key] = store.clock
+	}
+	return store, nil
+}
+
+// Save writes the tickets to path, replacing the file at once so a concurrent LoadTLSSessionStore never reads half of it.
+// Tickets are secrets, they resume sessions without a full handshake: the file is only readable by its owner.
+func (s *TLSSessionStore) Save(path string) error {
+	s.mu.Lock()
+	data, err := json.Marshal(s.tickets)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Get returns the ticket of the server.
+func (s *TLSSessionStore) Get(key string) (TLSSessionTicket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ticket, ok := s.tickets[key]
+	if ok {
+		s.clock++
+		s.lastUsed[key] = s.clock
+	}
+	return ticket, ok
+}
+
+// Put stores the ticket of the server, replacing the previous one as a TLS 1.3 server sends several per connection.
+// The least recently used server is forgotten once the store is full.
+func (s *TLSSessionStore) Put(key string, ticket TLSSessionTicket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[key]; !ok && len(s.tickets) >= s.capacity {
+		oldest := ""
+		for k, used := range s.lastUsed {
+			if oldest == "" || used < s.lastUsed[oldest] {
+				oldest = k
+			}
+		}
+		delete(s.tickets, oldest)
+		delete(s.lastUsed, oldest)
+	}
+	s.clock++
+	s.tickets[key] = ticket
+	s.lastUsed[key] = s.clock
+}
+
+// Delete forgets the ticket of the server, as the TLS stacks do once it was rejected.
+func (s *TLSSessionStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tickets, key)
+	delete(s.lastUsed, key)
+}
+
+// Len returns the number of servers with a ticket.
+func (s *TLSSessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tickets)
+}
+
+// ResumesTLSSessions reports whether the browser resumes TLS sessions.
+// Tor Browser disables session identifiers, they would link its connections to each other.
+func ResumesTLSSessions(impersonateOption ImpersonateOption) bool {
+	return impersonateOption.Browser.Type != BrowserTorBrowser
+}
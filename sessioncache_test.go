@@ -0,0 +1,100 @@
+package browser_impersonate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSSessionStore(t *testing.T) {
+	store := NewTLSSessionStore()
+	store.capacity = 2
+	store.Put("a.example.com", TLSSessionTicket{Ticket: []byte("a1")})
+	store.Put("a.example.com", TLSSessionTicket{Ticket: []byte("a2")})
+	store.Put("b.example.com", TLSSessionTicket{Ticket: []byte("b")})
+	// a.example.com is used after b.example.com, b.example.com is forgotten first
+	store.Get("a.example.com")
+	store.Put("c.example.com", TLSSessionTicket{Ticket: []byte("c")})
+	store.Delete("missing.example.com")
+
+	tests := []struct {
+		key    string
+		ticket string
+		ok     bool
+	}{
+		{key: "a.example.com", ticket: "a2", ok: true},
+		{key: "b.example.com"},
+		{key: "c.example.com", ticket: "c", ok: true},
+	}
+	for _, test := range tests {
+		ticket, ok := store.Get(test.key)
+		if ok != test.ok || string(ticket.Ticket) != test.ticket {
+			t.Errorf("Get(%q) = %q, %v, want %q, %v", test.key, ticket.Ticket, ok, test.ticket, test.ok)
+		}
+	}
+	if store.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", store.Len())
+	}
+	store.Delete("a.example.com")
+	if _, ok := store.Get("a.example.com"); ok || store.Len() != 1 {
+		t.Errorf("Delete() kept the ticket, Len() = %d", store.Len())
+	}
+}
+
+func TestTLSSessionStoreSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.json")
+	store, err := LoadTLSSessionStore(path)
+	if err != nil {
+		t.Fatalf("LoadTLSSessionStore() of a missing file: %v", err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("Len() = %d, want 0", store.Len())
+	}
+	ticket := TLSSessionTicket{Ticket: []byte{1, 2, 3}, State: []byte{4, 5}}
+	store.Put("example.com", ticket)
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("saved with mode %o, want 600", mode)
+	}
+	loaded, err := LoadTLSSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := loaded.Get("example.com")
+	if !ok || !bytes.Equal(got.Ticket, ticket.Ticket) || !bytes.Equal(got.State, ticket.State) {
+		t.Errorf("loaded ticket %+v, %v, want %+v", got, ok, ticket)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTLSSessionStore(path); err == nil {
+		t.Errorf("LoadTLSSessionStore() of a truncated file succeeded")
+	}
+}
+
+func TestResumesTLSSessions(t *testing.T) {
+	tests := []struct {
+		browser BrowserType
+		want    bool
+	}{
+		{browser: BrowserChrome, want: true},
+		{browser: BrowserFirefox, want: true},
+		{browser: BrowserFirefoxESR, want: true},
+		{browser: BrowserSafari, want: true},
+		{browser: BrowserTorBrowser, want: false},
+	}
+	for _, test := range tests {
+		option := ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: test.browser}}
+		if got := ResumesTLSSessions(option); got != test.want {
+			t.Errorf("ResumesTLSSessions(%s) = %v, want %v", test.browser, got, test.want)
+		}
+	}
+}
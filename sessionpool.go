@@ -0,0 +1,259 @@
+package browser_impersonate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSessionPoolClosed is returned by Lease once the pool is shut down.
+var ErrSessionPoolClosed = errors.New("browser_impersonate: session pool is shut down")
+
+// PersonaGenerator returns the persona of a new session of a SessionPool.
+// Each call should return a persona of its own: sessions keep theirs until they are retired.
+type PersonaGenerator func() (ImpersonateOption, error)
+
+// SessionPoolOptions bound the number and the life of the sessions of a SessionPool, 0 leaves a bound out.
+type SessionPoolOptions struct {
+	MaxSessions int           // Sessions alive at once, Lease waits for one to be released beyond it
+	MaxRequests int64         // Requests after which a session is retired
+	MaxLifetime time.Duration // Age after which a session is retired
+	MaxIdle     int           // Idle sessions kept for reuse, the others are retired when released
+}
+
+// SessionPoolStats are the counters of a SessionPool.
+type SessionPoolStats struct {
+	Idle    int
+	Leased  int
+	Created int
+	Retired int
+}
+
+// sessionBackend creates and closes the sessions of a SessionPool, one per backend.
+type sessionBackend[S any] interface {
+	newSession(impersonateOption ImpersonateOption) (S, error)
+	requests(session S) int64
+	closeIdleConnections(session S)
+	close(session S)
+}
+
+type pooledSession[S any] struct {
+	session S
+	persona ImpersonateOption
+	created time.Time
+}
+
+// SessionPool creates sessions with the personas of a generator and leases them to one goroutine at a time.
+// Every session has a persona of its own, with its own connections and cookie jar, so personas never share state.
+// Sessions are retired after MaxRequests requests or MaxLifetime, their proxy binding is released with them.
+type SessionPool[S any] struct {
+	mu        sync.Mutex
+	backend   sessionBackend[S]
+	generator PersonaGenerator
+	options   SessionPoolOptions
+	idle      []*pooledSession[S]
+	leased    int
+	closing   int // Retired sessions being closed, outside of mu
+	stats     SessionPoolStats
+	closed    bool
+	released  chan struct{} // Closed and replaced whenever a session is released or retired
+}
+
+func newSessionPool[S any](backend sessionBackend[S], generator PersonaGenerator, options SessionPoolOptions) *SessionPool[S] {
+	return &SessionPool[S]{backend: backend, generator: generator, options: options, released: make(chan struct{})}
+}
+
+// SessionLease is a session leased to a goroutine, which hands it back with Release or Retire once done.
+type SessionLease[S any] struct {
+	Session S
+	Persona ImpersonateOption
+	pool    *SessionPool[S]
+	pooled  *pooledSession[S]
+	done    atomic.Bool
+}
+
+// NewSessionLease wraps a session created outside of a pool, for the functions taking a lease.
+// Release and Retire leave it open, and it cannot be renewed.
+func NewSessionLease[S any](session S, persona ImpersonateOption) *SessionLease[S] {
+	return &SessionLease[S]{Session: session, Persona: persona}
+}
+
+// Lease returns an idle session, or a new one while the pool has room for it, waiting for a release otherwise.
+func (p *SessionPool[S]) Lease(ctx context.Context) (*SessionLease[S], error) {
+	for {
+		var retired []*pooledSession[S]
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrSessionPoolClosed
+		}
+		for len(p.idle) > 0 {
+			// Oldest first, so the sessions age evenly
+			pooled := p.idle[0]
+			p.idle = p.idle[1:]
+			if p.expired(pooled) {
+				p.retire(pooled)
+				retired = append(retired, pooled)
+				continue
+			}
+			p.leased++
+			p.mu.Unlock()
+			p.close(retired...)
+			return &SessionLease[S]{Session: pooled.session, Persona: pooled.persona, pool: p, pooled: pooled}, nil
+		}
+		if p.options.MaxSessions == 0 || p.leased < p.options.MaxSessions {
+			// Created outside the lock, the slot is taken meanwhile
+			p.leased++
+			p.mu.Unlock()
+			p.close(retired...)
+			pooled, err := p.create()
+			if err != nil {
+				p.mu.Lock()
+				p.leased--
+				p.signal()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return &SessionLease[S]{Session: pooled.session, Persona: pooled.persona, pool: p, pooled: pooled}, nil
+		}
+		released := p.released
+		p.mu.Unlock()
+		p.close(retired...)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// Release hands the session back for reuse, it is retired instead once it reached its limits.
+// Only the first Release or Retire of a lease hands its session back.
+func (l *SessionLease[S]) Release() {
+	if l.done.CompareAndSwap(false, true) && l.pool != nil {
+		l.pool.release(l.pooled, false)
+	}
+}
+
+// Retire hands the session back to be closed, when its persona got blocked for instance.
+func (l *SessionLease[S]) Retire() {
+	if l.done.CompareAndSwap(false, true) && l.pool != nil {
+		l.pool.release(l.pooled, true)
+	}
+}
+
+// Renew retires the session and returns the lease of another session of the pool, with a persona of its own.
+// The lease is over once renewed, even when leasing the next session fails.
+func (l *SessionLease[S]) Renew(ctx context.Context) (*SessionLease[S], error) {
+	if l.pool == nil {
+		return nil, errors.New("browser_impersonate: the session of the lease has no pool to renew it from")
+	}
+	l.Retire()
+	return l.pool.Lease(ctx)
+}
+
+// Stats returns the counters of the pool.
+func (p *SessionPool[S]) Stats() SessionPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	stats.Leased = p.leased
+	return stats
+}
+
+// Shutdown stops leasing, closes the idle sessions and then the leased ones as they are released.
+// Once ctx is done it stops waiting, the sessions still leased are closed when released.
+func (p *SessionPool[S]) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	for _, pooled := range idle {
+		p.retire(pooled)
+	}
+	p.mu.Unlock()
+	p.close(idle...)
+	for {
+		p.mu.Lock()
+		if p.leased == 0 && p.closing == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		released := p.released
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+func (p *SessionPool[S]) create() (*pooledSession[S], error) {
+	persona, err := p.generator()
+	if err != nil {
+		return nil, err
+	}
+	session, err := p.backend.newSession(persona)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.stats.Created++
+	p.mu.Unlock()
+	return &pooledSession[S]{session: session, persona: persona, created: time.Now()}, nil
+}
+
+func (p *SessionPool[S]) release(pooled *pooledSession[S], retire bool) {
+	p.mu.Lock()
+	p.leased--
+	retire = retire || p.closed || p.expired(pooled) || p.options.MaxIdle > 0 && len(p.idle) >= p.options.MaxIdle
+	if retire {
+		p.retire(pooled)
+	} else {
+		p.idle = append(p.idle, pooled)
+	}
+	p.signal()
+	p.mu.Unlock()
+	if retire {
+		p.close(pooled)
+	}
+}
+
+func (p *SessionPool[S]) expired(pooled *pooledSession[S]) bool {
+	if p.options.MaxRequests > 0 && p.backend.requests(pooled.session) >= p.options.MaxRequests {
+		return true
+	}
+	return p.options.MaxLifetime > 0 && time.Since(pooled.created) >= p.options.MaxLifetime
+}
+
+// retire counts the session out, p.mu is held. The caller closes it once it unlocked p.mu.
+func (p *SessionPool[S]) retire(pooled *pooledSession[S]) {
+	p.stats.Retired++
+	p.closing++
+}
+
+// close closes the retired sessions with their connections and forgets the proxies of their personas, p.mu is not held.
+func (p *SessionPool[S]) close(retired ...*pooledSession[S]) {
+	for _, pooled := range retired {
+		p.backend.closeIdleConnections(pooled.session)
+		p.backend.close(pooled.session)
+		if pooled.persona.ProxyPool != nil {
+			pooled.persona.ProxyPool.Release(pooled.persona.ProxyKey)
+		}
+	}
+	if len(retired) > 0 {
+		p.mu.Lock()
+		p.closing -= len(retired)
+		p.signal()
+		p.mu.Unlock()
+	}
+}
+
+func (p *SessionPool[S]) signal() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
@@ -0,0 +1,324 @@
+package browser_impersonate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeSession struct {
+	id       int
+	requests atomic.Int64
+	leased   atomic.Bool
+	closed   atomic.Int32
+	mu       sync.Mutex
+	proxyURL string
+}
+
+// Backend of fake sessions, checking the pool never closes one with its lock held.
+type fakeSessionBackend struct {
+	t        *testing.T
+	pool     *SessionPool[*fakeSession]
+	mu       sync.Mutex
+	sessions []*fakeSession
+}
+
+func (b *fakeSessionBackend) newSession(impersonateOption ImpersonateOption) (*fakeSession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	session := &fakeSession{id: len(b.sessions)}
+	if impersonateOption.ProxyPool != nil {
+		proxyURL, err := impersonateOption.ProxyPool.Acquire(impersonateOption.ProxyKey)
+		if err != nil {
+			return nil, err
+		}
+		session.proxyURL = proxyURL
+	}
+	b.sessions = append(b.sessions, session)
+	return session, nil
+}
+
+func (b *fakeSessionBackend) requests(session *fakeSession) int64 {
+	return session.requests.Load()
+}
+
+func (b *fakeSessionBackend) closeIdleConnections(session *fakeSession) {}
+
+func (b *fakeSessionBackend) close(session *fakeSession) {
+	// Stats locks the pool, closing with it held would deadlock
+	done := make(chan struct{})
+	go func() {
+		b.pool.Stats()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		b.t.Error("session closed with the pool locked")
+	}
+	session.closed.Add(1)
+}
+
+func (b *fakeSessionBackend) proxy(session *fakeSession) string {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.proxyURL
+}
+
+func (b *fakeSessionBackend) setProxy(session *fakeSession, proxyURL string) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.proxyURL = proxyURL
+	return nil
+}
+
+func (b *fakeSessionBackend) proxySchemes() []string {
+	return nil
+}
+
+func newFakeSessionPool(t *testing.T, generator PersonaGenerator, options SessionPoolOptions) (*SessionPool[*fakeSession], *fakeSessionBackend) {
+	t.Helper()
+	if generator == nil {
+		generator = func() (ImpersonateOption, error) {
+			return ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}, nil
+		}
+	}
+	backend := &fakeSessionBackend{t: t}
+	backend.pool = newSessionPool[*fakeSession](backend, generator, options)
+	return backend.pool, backend
+}
+
+func leaseFakeSession(t *testing.T, pool *SessionPool[*fakeSession]) *SessionLease[*fakeSession] {
+	t.Helper()
+	lease, err := pool.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lease
+}
+
+func TestSessionPoolReusesSessions(t *testing.T) {
+	pool, _ := newFakeSessionPool(t, nil, SessionPoolOptions{})
+	lease := leaseFakeSession(t, pool)
+	first := lease.Session
+	lease.Release()
+	// A lease hands its session back once
+	lease.Release()
+	lease.Retire()
+	lease = leaseFakeSession(t, pool)
+	if lease.Session != first {
+		t.Fatalf("got session %d, want the idle session %d", lease.Session.id, first.id)
+	}
+	if stats := pool.Stats(); stats != (SessionPoolStats{Leased: 1, Created: 1}) {
+		t.Fatalf("got %+v", stats)
+	}
+	lease.Retire()
+	if first.closed.Load() != 1 {
+		t.Fatal("retired session not closed")
+	}
+	if stats := pool.Stats(); stats != (SessionPoolStats{Created: 1, Retired: 1}) {
+		t.Fatalf("got %+v", stats)
+	}
+}
+
+func TestSessionPoolRetiresSessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options SessionPoolOptions
+		use     func(session *fakeSession)
+	}{
+		{name: "MaxRequests", options: SessionPoolOptions{MaxRequests: 2}, use: func(session *fakeSession) { session.requests.Add(2) }},
+		{name: "MaxLifetime", options: SessionPoolOptions{MaxLifetime: time.Nanosecond}, use: func(session *fakeSession) { time.Sleep(time.Millisecond) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxyPool := newTestProxyPool(t, []string{"http://a.example:8080"}, ProxyPoolOptions{})
+			generator := func() (ImpersonateOption, error) {
+				if _, err := proxyPool.Acquire("persona"); err != nil {
+					return ImpersonateOption{}, err
+				}
+				return ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, ProxyPool: proxyPool, ProxyKey: "persona"}, nil
+			}
+			pool, _ := newFakeSessionPool(t, generator, test.options)
+			lease := leaseFakeSession(t, pool)
+			session := lease.Session
+			test.use(session)
+			lease.Release()
+			if session.closed.Load() != 1 {
+				t.Fatal("session past its limit not closed")
+			}
+			if keys := proxyKeys(proxyPool); keys[0] != 0 {
+				t.Fatalf("got keys %v, want the proxy of the persona released", keys)
+			}
+			if lease := leaseFakeSession(t, pool); lease.Session == session {
+				t.Fatal("got the retired session again")
+			}
+		})
+	}
+}
+
+func TestSessionPoolMaxIdle(t *testing.T) {
+	pool, backend := newFakeSessionPool(t, nil, SessionPoolOptions{MaxIdle: 1})
+	leases := []*SessionLease[*fakeSession]{}
+	for range 3 {
+		leases = append(leases, leaseFakeSession(t, pool))
+	}
+	for _, lease := range leases {
+		lease.Release()
+	}
+	if stats := pool.Stats(); stats != (SessionPoolStats{Idle: 1, Created: 3, Retired: 2}) {
+		t.Fatalf("got %+v", stats)
+	}
+	closed := 0
+	for _, session := range backend.sessions {
+		closed += int(session.closed.Load())
+	}
+	if closed != 2 {
+		t.Fatalf("got %d sessions closed, want 2", closed)
+	}
+}
+
+func TestSessionPoolMaxSessions(t *testing.T) {
+	pool, _ := newFakeSessionPool(t, nil, SessionPoolOptions{MaxSessions: 1})
+	lease := leaseFakeSession(t, pool)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Lease(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the lease to wait", err)
+	}
+	leased := make(chan *SessionLease[*fakeSession])
+	go func() {
+		lease, err := pool.Lease(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		leased <- lease
+	}()
+	time.Sleep(10 * time.Millisecond)
+	first := lease.Session
+	lease.Release()
+	if lease := <-leased; lease == nil || lease.Session != first {
+		t.Fatal("waiting lease did not get the released session")
+	}
+}
+
+func TestSessionPoolGeneratorError(t *testing.T) {
+	generated := false
+	pool, _ := newFakeSessionPool(t, func() (ImpersonateOption, error) {
+		if !generated {
+			generated = true
+			return ImpersonateOption{}, errors.New("no persona")
+		}
+		return ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}}, nil
+	}, SessionPoolOptions{MaxSessions: 1})
+	if _, err := pool.Lease(context.Background()); err == nil {
+		t.Fatal("got no error")
+	}
+	// The slot taken for the failed session is given back
+	leaseFakeSession(t, pool).Release()
+}
+
+func TestSessionPoolShutdown(t *testing.T) {
+	pool, backend := newFakeSessionPool(t, nil, SessionPoolOptions{})
+	idle, leased := leaseFakeSession(t, pool), leaseFakeSession(t, pool)
+	idle.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want Shutdown to wait for the leased session", err)
+	}
+	if backend.sessions[0].closed.Load() != 1 || backend.sessions[1].closed.Load() != 0 {
+		t.Fatal("want only the idle session closed")
+	}
+	if _, err := pool.Lease(context.Background()); !errors.Is(err, ErrSessionPoolClosed) {
+		t.Fatalf("got %v, want ErrSessionPoolClosed", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- pool.Shutdown(context.Background()) }()
+	leased.Release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if backend.sessions[1].closed.Load() != 1 {
+		t.Fatal("session released after the shutdown not closed")
+	}
+}
+
+func TestSessionPoolConcurrentLeases(t *testing.T) {
+	const maxSessions = 4
+	pool, backend := newFakeSessionPool(t, nil, SessionPoolOptions{MaxSessions: maxSessions, MaxRequests: 5, MaxIdle: 2})
+	var inUse, maxInUse atomic.Int32
+	var wg sync.WaitGroup
+	for worker := range 16 {
+		wg.Go(func() {
+			for n := range 50 {
+				lease, err := pool.Lease(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !lease.Session.leased.CompareAndSwap(false, true) {
+					t.Error("session leased twice at once")
+				}
+				current := inUse.Add(1)
+				for {
+					previous := maxInUse.Load()
+					if current <= previous || maxInUse.CompareAndSwap(previous, current) {
+						break
+					}
+				}
+				lease.Session.requests.Add(1)
+				inUse.Add(-1)
+				lease.Session.leased.Store(false)
+				if (worker+n)%7 == 0 {
+					lease.Retire()
+				} else {
+					lease.Release()
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if maxInUse.Load() > maxSessions {
+		t.Fatalf("got %d sessions leased at once, want at most %d", maxInUse.Load(), maxSessions)
+	}
+	stats := pool.Stats()
+	if stats.Idle != 0 || stats.Leased != 0 || stats.Created != len(backend.sessions) || stats.Retired != stats.Created {
+		t.Fatalf("got %+v", stats)
+	}
+	for _, session := range backend.sessions {
+		if session.closed.Load() != 1 {
+			t.Fatalf("session %d closed %d times", session.id, session.closed.Load())
+		}
+	}
+}
+
+func TestSessionLeaseRenew(t *testing.T) {
+	pool, _ := newFakeSessionPool(t, nil, SessionPoolOptions{})
+	lease := leaseFakeSession(t, pool)
+	next, err := lease.Renew(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == lease || next.Session == lease.Session || lease.Session.closed.Load() != 1 {
+		t.Fatal("want a new lease of another session, the renewed one closed")
+	}
+	// The renewed lease is over, handing it back again leaves the new one alone
+	lease.Release()
+	if stats := pool.Stats(); stats != (SessionPoolStats{Leased: 1, Created: 2, Retired: 1}) {
+		t.Fatalf("got %+v", stats)
+	}
+	next.Release()
+
+	if _, err := NewSessionLease(&fakeSession{}, ImpersonateOption{}).Renew(context.Background()); err == nil {
+		t.Fatal("got no error renewing a lease without pool")
+	}
+}
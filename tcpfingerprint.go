@@ -0,0 +1,45 @@
+package browser_impersonate
+
+import "syscall"
+
+// TCPProfile is what the TCP/IP stack of an OS shows in the SYN of a connection, as p0f-style checks read it.
+type TCPProfile struct {
+	TTL         int    // Initial IPv4 TTL and IPv6 hop limit
+	MSS         int    // Maximum segment size on Ethernet
+	Window      uint16 // Window of the SYN on the OS. Not sent from Linux, which keeps its own, it only bounds the window scale
+	WindowScale int    // Window scale of the SYN
+	Timestamps  bool   // Whether the SYN carries TCP timestamps, a system-wide setting on Linux (net.ipv4.tcp_timestamps)
+}
+
+// Windows sends MSS,NOP,WS,NOP,NOP,SACK_PERM without timestamps, macOS and iOS MSS,NOP,WS,NOP,NOP,TS,SACK_PERM,EOL.
+var (
+	WindowsTCPProfile = TCPProfile{TTL: 128, MSS: 1460, Window: 64240, WindowScale: 8}
+	AppleTCPProfile   = TCPProfile{TTL: 64, MSS: 1460, Window: 65535, WindowScale: 6, Timestamps: true}
+)
+
+// GetTCPProfile returns the TCP profile of the impersonated OS, false for Linux and Android which share the stack of the host.
+func GetTCPProfile(impersonateOption ImpersonateOption) (TCPProfile, bool) {
+	switch impersonateOption.OS {
+	case Windows:
+		return WindowsTCPProfile, true
+	case MacOS, IOS:
+		return AppleTCPProfile, true
+	default:
+		return TCPProfile{}, false
+	}
+}
+
+// GetTCPControl returns the net.Dialer Control setting the TCP profile of the impersonated OS on the sockets,
+// nil when TCPFingerprint is off, the OS shares the stack of the host or the host is not Linux.
+// The option order of the SYN, its window, timestamps and SACK cannot be set per socket, they stay those of Linux,
+// and a window scale above the one of the host needs net.ipv4.tcp_rmem to be raised.
+func GetTCPControl(impersonateOption ImpersonateOption) func(network string, address string, c syscall.RawConn) error {
+	if !impersonateOption.TCPFingerprint {
+		return nil
+	}
+	profile, ok := GetTCPProfile(impersonateOption)
+	if !ok {
+		return nil
+	}
+	return tcpProfileControl(profile)
+}
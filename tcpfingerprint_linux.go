@@ -0,0 +1,32 @@
+package browser_impersonate
+
+import (
+	"strings"
+	"syscall"
+)
+
+func tcpProfileControl(profile TCPProfile) func(network string, address string, c syscall.RawConn) error {
+	return func(network string, address string, c syscall.RawConn) error {
+		var err error
+		controlErr := c.Control(func(fd uintptr) {
+			if strings.HasSuffix(network, "6") {
+				err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, profile.TTL)
+			} else {
+				err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, profile.TTL)
+			}
+			if err != nil || !strings.HasPrefix(network, "tcp") {
+				return
+			}
+			// Set before connecting, the SYN advertises the smaller of it and the MSS of the interface
+			if err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, profile.MSS); err != nil {
+				return
+			}
+			// The clamp only lowers the window scale of the SYN to the one it needs, the SYN window stays the one of Linux
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_WINDOW_CLAMP, int(profile.Window)<<profile.WindowScale)
+		})
+		if controlErr != nil {
+			return controlErr
+		}
+		return err
+	}
+}
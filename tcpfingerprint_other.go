@@ -0,0 +1,9 @@
+//go:build !linux
+
+package browser_impersonate
+
+import "syscall"
+
+func tcpProfileControl(profile TCPProfile) func(network string, address string, c syscall.RawConn) error {
+	return nil
+}
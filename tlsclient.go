@@ -3,56 +3,330 @@
 package browser_impersonate
 
 import (
-	"fmt"
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 
 	fhttp "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/fhttp/httptrace"
 	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
 )
 
 // NewImpersonateTLShttpClient is a tls_client.NewHttpClient wrapper, with the option to set emulated device and browser
 // will set default request headers, tls fingerprinting, and tls profile of the emulation target.
 func NewImpersonateTLShttpClient(impersonateOption ImpersonateOption, logger tls_client.Logger, options ...tls_client.HttpClientOption) (tls_client.HttpClient, error) {
+	if err := impersonateOption.Validate(); err != nil {
+		return nil, err
+	}
+	if impersonateOption.TLSSessionStore != nil {
+		return nil, &UnsupportedCombinationError{OS: impersonateOption.OS, Browser: impersonateOption.Browser.Type, Reason: "tls-client keeps a TLS session cache of its own, TLSSessionStore is only used by azuretls"}
+	}
+	if impersonateOption.ECHResolver != nil {
+		return nil, &UnsupportedCombinationError{OS: impersonateOption.OS, Browser: impersonateOption.Browser.Type, Reason: "tls-client only sends GREASE ECH, ECHResolver is only used by azuretls"}
+	}
 	// setup default headers:
-	// &impersonateOption
 	newOptions := []tls_client.HttpClientOption{}
 
 	// Headers
+	defaultHeaders := make(fhttp.Header)
 	if !impersonateOption.SkipHeaders {
-		defaultHeaders := make(fhttp.Header)
 		ImpersonateHeaders(defaultHeaders, impersonateOption, true)
 		if !impersonateOption.SkipHeaderOrder {
 			defaultHeaders[fhttp.HeaderOrderKey] = GetHeaderOrder(impersonateOption)
 		}
 		newOptions = append(newOptions, tls_client.WithDefaultHeaders(defaultHeaders))
-		if defaultHeaders.Get("User-Agent") == "" {
-			fmt.Println(impersonateOption)
+		connectHeaders := fhttp.Header(GetProxyConnectHeaders(impersonateOption))
+		connectHeaders[fhttp.HeaderOrderKey] = GetProxyConnectHeaderOrderKey(impersonateOption)
+		newOptions = append(newOptions, tls_client.WithConnectHeaders(connectHeaders))
+	}
+	if dialer, ok := GetDialer(impersonateOption); ok {
+		newOptions = append(newOptions, tls_client.WithDialer(dialer))
+	}
+	if impersonateOption.ProxyPool != nil {
+		proxyURL, err := impersonateOption.ProxyPool.Acquire(impersonateOption.ProxyKey, tlsClientProxySchemes...)
+		if err != nil {
+			return nil, err
 		}
-		//fmt.Println(defaultHeaders)
+		newOptions = append(newOptions, tls_client.WithProxyUrl(proxyURL))
 	}
 	// TLS Client Profile:
-	switch impersonateOption.Browser.Type {
-	case BrowserSafari:
+	var clientProfile profiles.ClientProfile
+	hasClientProfile := true
+	switch {
+	case impersonateOption.Browser.Type == BrowserOkHttp:
+		clientProfile = GetOkHttpClientProfile(impersonateOption)
+	case impersonateOption.Browser.Type == BrowserCFNetwork:
+		clientProfile = CFNetwork_IOS_26
+	case impersonateOption.Browser.Type == BrowserChrome && impersonateOption.OS == IOS:
+		clientProfile = WithTLSExtensionSeed(Chrome142_IOS_26, GetTLSExtensionSeed(impersonateOption))
+	case impersonateOption.UsesWebKit():
 		switch impersonateOption.OS {
 		case MacOS:
-			// newOptions = append(newOptions, tls_client.WithClientProfile())
+			// clientProfile = ...
+			hasClientProfile = false
 		case IOS:
-			newOptions = append(newOptions, tls_client.WithClientProfile(Safari_IOS_26))
+			// Every other iOS browser uses the WebKit stack, as do iPads even when presenting a macOS User-Agent.
+			clientProfile = Safari_IOS_26
 		}
-	case BrowserChrome, BrowserBrave, BrowserEdge:
-		newOptions = append(newOptions, tls_client.WithRandomTLSExtensionOrder())
-		if impersonateOption.Browser.Type == BrowserChrome && impersonateOption.OS == IOS {
-			newOptions = append(newOptions, tls_client.WithClientProfile(Chrome142_IOS_26))
-		} else {
-			newOptions = append(newOptions, tls_client.WithClientProfile(Chrome141_ClientProfile))
+	case impersonateOption.Browser.Type.IsChromium():
+		// One extension order per session, as Chrome shuffles once per launch
+		clientProfile = WithTLSExtensionSeed(Chrome141_ClientProfile, GetTLSExtensionSeed(impersonateOption))
+	case impersonateOption.Browser.Type.IsGecko():
+		clientProfile = GetGeckoClientProfile(impersonateOption.Browser)
+	default:
+		hasClientProfile = false
+	}
+	if hasClientProfile {
+		if !ResumesTLSSessions(impersonateOption) {
+			clientProfile = WithoutSessionResumption(clientProfile)
 		}
-	case BrowserFirefox:
-		newOptions = append(newOptions, tls_client.WithClientProfile(FirefoxClientProfile))
+		clientProfile = WithPostQuantumGroup(clientProfile, impersonateOption)
+		newOptions = append(newOptions, tls_client.WithClientProfile(WithHTTP2Priorities(clientProfile, impersonateOption)))
 	}
 	// newOptions = append(newOptions, tls_client.WithDefaultHeaders(fhttp.Header{}))
 	finalOpts := append(newOptions, options...)
 	newClient, err := tls_client.NewHttpClient(logger, finalOpts...)
-	if err == nil {
-		// Do something with the client here
+	if err != nil {
+		return nil, err
+	}
+	return &impersonatedTLSClient{HttpClient: newClient, impersonateOption: impersonateOption, defaultHeaders: defaultHeaders}, nil
+}
+
+// tls-client has no SOCKS4 dialer, its clients are only bound to the other proxies of a ProxyPool.
+var tlsClientProxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// impersonatedTLSClient recomputes the headers of requests carrying RequestHints in their context,
+// and of plain http:// requests, other requests get the default headers set on the client.
+// Generated headers are rewritten to their HTTP/1.1 form for origins ALPN did not pick h2 with.
+type impersonatedTLSClient struct {
+	tls_client.HttpClient
+	impersonateOption ImpersonateOption
+	defaultHeaders    fhttp.Header
+	requests          atomic.Int64
+	protocols         negotiatedProtocols
+	// tls-client replaces its transport unlocked when the proxy changes, requests hold proxyMu for reading meanwhile
+	proxyMu sync.RWMutex
+}
+
+// Get, Head and Post go through Do, the embedded client would send their requests itself.
+func (c *impersonatedTLSClient) Get(url string) (*fhttp.Response, error) {
+	req, err := fhttp.NewRequest(fhttp.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *impersonatedTLSClient) Head(url string) (*fhttp.Response, error) {
+	req, err := fhttp.NewRequest(fhttp.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *impersonatedTLSClient) Post(url string, contentType string, body io.Reader) (*fhttp.Response, error) {
+	req, err := fhttp.NewRequest(fhttp.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+func (c *impersonatedTLSClient) Do(req *fhttp.Request) (*fhttp.Response, error) {
+	c.requests.Add(1)
+	c.proxyMu.RLock()
+	proxyURL := c.HttpClient.GetProxy()
+	resp, err := c.do(req)
+	c.proxyMu.RUnlock()
+	// Requests the caller gave up on say nothing about the proxy
+	if pool := c.impersonateOption.ProxyPool; pool != nil && req.Context().Err() == nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		if next, rotated := pool.Report(c.impersonateOption.ProxyKey, proxyURL, statusCode, err, tlsClientProxySchemes...); rotated {
+			if err := c.swapProxy(proxyURL, next); err != nil {
+				return resp, err
+			}
+		}
+	}
+	return resp, err
+}
+
+// swapProxy moves the client from the proxy from to proxyURL, unless a concurrent request did already.
+func (c *impersonatedTLSClient) swapProxy(from string, proxyURL string) error {
+	c.proxyMu.Lock()
+	defer c.proxyMu.Unlock()
+	if current := c.HttpClient.GetProxy(); current != from || current == proxyURL {
+		return nil
+	}
+	return c.setProxy(proxyURL)
+}
+
+func (c *impersonatedTLSClient) SetProxy(proxyURL string) error {
+	c.proxyMu.Lock()
+	defer c.proxyMu.Unlock()
+	return c.setProxy(proxyURL)
+}
+
+// setProxy closes the idle connections to the previous proxy first, tls-client would leave them in the transport it drops.
+// No request is in flight, proxyMu is held.
+func (c *impersonatedTLSClient) setProxy(proxyURL string) error {
+	c.HttpClient.CloseIdleConnections()
+	return c.HttpClient.SetProxy(proxyURL)
+}
+
+func (c *impersonatedTLSClient) GetProxy() string {
+	c.proxyMu.RLock()
+	defer c.proxyMu.RUnlock()
+	return c.HttpClient.GetProxy()
+}
+
+func (c *impersonatedTLSClient) CloseIdleConnections() {
+	c.proxyMu.RLock()
+	defer c.proxyMu.RUnlock()
+	c.HttpClient.CloseIdleConnections()
+}
+
+func (c *impersonatedTLSClient) do(req *fhttp.Request) (*fhttp.Response, error) {
+	if c.impersonateOption.SkipHeaders {
+		return c.HttpClient.Do(req)
+	}
+	hints, ok := RequestHintsFromContext(req.Context())
+	setOrder := !c.impersonateOption.SkipHeaderOrder && len(req.Header[fhttp.HeaderOrderKey]) == 0
+	// The caller keeps its request as it was, the headers are rewritten on a clone
+	switch {
+	case ok || req.URL.Scheme == "http":
+		headers := make(fhttp.Header)
+		ImpersonateRequestHeaders(headers, c.impersonateOption, hints, req.Method, req.URL)
+		// Headers set on the request by the caller win
+		for k, v := range req.Header {
+			headers[k] = v
+		}
+		if setOrder {
+			headers[fhttp.HeaderOrderKey] = GetRequestHeaderOrder(c.impersonateOption, req.URL)
+		}
+		req = req.Clone(req.Context())
+		req.Header = headers
+	case len(req.Header) == 0:
+		req = req.Clone(req.Context())
+		req.Header = c.defaultHeaders.Clone()
+	default:
+		// The caller took control of the headers
+		return c.HttpClient.Do(req)
+	}
+
+	toHTTP1 := func(headers fhttp.Header) {
+		ImpersonateHTTP1Headers(headers, c.impersonateOption)
+		if setOrder {
+			headers[fhttp.HeaderOrderKey] = GetHTTP1HeaderOrderKey(c.impersonateOption)
+		}
+	}
+	if http1, known := c.protocols.usesHTTP1(req.URL); known {
+		if http1 {
+			toHTTP1(req.Header)
+		}
+	} else {
+		// First connection to the origin: both fhttp transports report it before writing the headers of the clone.
+		// Connections not telling their ALPN keep the HTTP/2 form, HTTP/1.1 writes it too.
+		headers := req.Header
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if conn, ok := info.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok && conn.ConnectionState().NegotiatedProtocol != "h2" {
+					toHTTP1(headers)
+				}
+			},
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err == nil && resp.Request != nil {
+		c.protocols.learn(resp.Request.URL, resp.ProtoMajor)
+	}
+	return resp, err
+}
+
+// NewTLSClientSessionPool returns a pool of tls-client clients impersonating the personas of generator.
+// Every client gets a cookie jar of its own, after the options.
+func NewTLSClientSessionPool(generator PersonaGenerator, sessionOptions SessionPoolOptions, logger tls_client.Logger, options ...tls_client.HttpClientOption) *SessionPool[tls_client.HttpClient] {
+	return newSessionPool[tls_client.HttpClient](tlsClientSessionBackend{logger: logger, options: options}, generator, sessionOptions)
+}
+
+type tlsClientSessionBackend struct {
+	logger  tls_client.Logger
+	options []tls_client.HttpClientOption
+}
+
+func (b tlsClientSessionBackend) newSession(impersonateOption ImpersonateOption) (tls_client.HttpClient, error) {
+	return NewImpersonateTLShttpClient(impersonateOption, b.logger, append(slices.Clone(b.options), tls_client.WithCookieJar(tls_client.NewCookieJar()))...)
+}
+
+func (b tlsClientSessionBackend) requests(client tls_client.HttpClient) int64 {
+	if impersonated, ok := client.(*impersonatedTLSClient); ok {
+		return impersonated.requests.Load()
+	}
+	return 0
+}
+
+func (b tlsClientSessionBackend) closeIdleConnections(client tls_client.HttpClient) {
+	client.CloseIdleConnections()
+}
+
+// tls-client has nothing to close but its connections
+func (b tlsClientSessionBackend) close(client tls_client.HttpClient) {}
+
+func (b tlsClientSessionBackend) proxy(client tls_client.HttpClient) string {
+	return client.GetProxy()
+}
+
+func (b tlsClientSessionBackend) setProxy(client tls_client.HttpClient, proxyURL string) error {
+	return client.SetProxy(proxyURL)
+}
+
+func (b tlsClientSessionBackend) proxySchemes() []string {
+	return tlsClientProxySchemes
+}
+
+// DoTLSClientWithRetry sends req with the client of the lease, retrying the attempts options classify as blocked.
+// Requests with a body are only retried when it can be replayed, fhttp.NewRequest allows it for byte and string readers.
+// The lease returned is the one to release, a new one once RotatePersona renewed it, nil when renewing failed.
+func DoTLSClientWithRetry(lease *SessionLease[tls_client.HttpClient], req *fhttp.Request, options RetryOptions) (*fhttp.Response, *SessionLease[tls_client.HttpClient], []RetryAttempt, error) {
+	if req.Body != nil && req.GetBody == nil {
+		options.MaxAttempts = 1
+	}
+	send := func(client tls_client.HttpClient) (*fhttp.Response, RetryResponse, error) {
+		// Headers are generated again for each attempt, by a new persona maybe
+		attempt := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, RetryResponse{}, err
+			}
+			attempt.Body = body
+		}
+		resp, err := client.Do(attempt)
+		if err != nil {
+			return nil, RetryResponse{}, err
+		}
+		peek, err := io.ReadAll(io.LimitReader(resp.Body, retryBodyPeekSize))
+		if err != nil {
+			resp.Body.Close()
+			return nil, RetryResponse{}, err
+		}
+		resp.Body = peekedBody{Reader: io.MultiReader(bytes.NewReader(peek), resp.Body), Closer: resp.Body}
+		return resp, RetryResponse{StatusCode: resp.StatusCode, Header: http.Header(resp.Header), Body: peek}, nil
+	}
+	discard := func(resp *fhttp.Response) {
+		if resp != nil {
+			resp.Body.Close()
+		}
 	}
-	return newClient, err
+	return doWithRetry(req.Context(), options, lease, leaseRetryBackend[tls_client.HttpClient](lease, tlsClientSessionBackend{}), send, discard)
 }
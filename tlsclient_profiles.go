@@ -3,6 +3,9 @@
 package browser_impersonate
 
 import (
+	"encoding/binary"
+	"slices"
+
 	"github.com/bogdanfinn/fhttp/http2"
 
 	"github.com/bogdanfinn/tls-client/profiles"
@@ -11,6 +14,172 @@ import (
 
 var FirefoxClientProfile = profiles.Firefox_135
 
+// Closest upstream profiles to each ESR branch, ESR keeps the TLS defaults of the release it branched from.
+var FirefoxESR115ClientProfile = profiles.Firefox_117
+var FirefoxESR128ClientProfile = profiles.Firefox_132
+var FirefoxESR140ClientProfile = profiles.Firefox_135
+
+// GetGeckoClientProfile returns the TLS profile of Firefox, Firefox ESR or Tor Browser.
+// Tor Browser ships the ESR network stack untouched, the fingerprinting resistance is above TLS.
+func GetGeckoClientProfile(browserInfo ImpersonateBrowser) profiles.ClientProfile {
+	if browserInfo.Type == BrowserFirefox {
+		return FirefoxClientProfile
+	}
+	switch GetGeckoVersion(browserInfo) {
+	case 115:
+		return FirefoxESR115ClientProfile
+	case 128:
+		return FirefoxESR128ClientProfile
+	default:
+		return FirefoxESR140ClientProfile
+	}
+}
+
+// GetOkHttpClientProfile returns the OkHttp profile of the Android version, OkHttp uses the TLS stack of the platform.
+func GetOkHttpClientProfile(impersonateOption ImpersonateOption) profiles.ClientProfile {
+	androidVersion := 13
+	if numbers := parseOSVersion(impersonateOption.GetOSVersion()); len(numbers) > 0 {
+		androidVersion = numbers[0]
+	}
+	switch {
+	case androidVersion <= 7:
+		return profiles.Okhttp4Android7
+	case androidVersion == 8:
+		return profiles.Okhttp4Android8
+	case androidVersion == 9:
+		return profiles.Okhttp4Android9
+	case androidVersion == 10:
+		return profiles.Okhttp4Android10
+	case androidVersion == 11:
+		return profiles.Okhttp4Android11
+	case androidVersion == 12:
+		return profiles.Okhttp4Android12
+	default:
+		return profiles.Okhttp4Android13
+	}
+}
+
+// WithHTTP2Priorities returns the profile with the PRIORITY frames and the HEADERS priority of the persona navigations.
+// The fhttp HTTP2 transport puts one priority on the HEADERS frames of every request,
+// subresources are only told apart by their Priority header.
+func WithHTTP2Priorities(clientProfile profiles.ClientProfile, impersonateOption ImpersonateOption) profiles.ClientProfile {
+	priorities := []http2.Priority{}
+	for _, frame := range GetHTTP2PriorityFrames(impersonateOption) {
+		priorities = append(priorities, http2.Priority{StreamID: frame.StreamID, PriorityParam: toHTTP2PriorityParam(frame.HTTP2Priority)})
+	}
+	headerPriority := toHTTP2PriorityParam(GetHTTP2Priority(impersonateOption, DestinationDocument))
+	return rebuildClientProfile(clientProfile, clientProfile.GetClientHelloId(), priorities, &headerPriority)
+}
+
+func toHTTP2PriorityParam(priority HTTP2Priority) http2.PriorityParam {
+	return http2.PriorityParam{StreamDep: priority.StreamDep, Exclusive: priority.Exclusive, Weight: priority.Weight}
+}
+
+// WithTLSExtensionSeed returns the profile with its extensions shuffled once from the seed, instead of on every connection.
+func WithTLSExtensionSeed(clientProfile profiles.ClientProfile, seed int64) profiles.ClientProfile {
+	if clientProfile.GetClientHelloId().SpecFactory == nil {
+		return clientProfile
+	}
+	clientProfile = wrapClientHelloSpec(clientProfile, func(spec *tls.ClientHelloSpec) error {
+		spec.Extensions = permuteExtensions(spec.Extensions, seed, getTLSExtensionID)
+		return nil
+	})
+	clientHelloId := clientProfile.GetClientHelloId()
+	clientHelloId.RandomExtensionOrder = false
+	return rebuildClientProfile(clientProfile, clientHelloId, clientProfile.GetPriorities(), clientProfile.GetHeaderPriority())
+}
+
+// WithPostQuantumGroup returns the profile offering the post-quantum group of the persona version, or none if it has none.
+// utls answers a HelloRetryRequest with a single key share for the group the server picked, as browsers do,
+// but cannot when it offered a session ticket: a server asking for another group then fails resumed handshakes.
+func WithPostQuantumGroup(clientProfile profiles.ClientProfile, impersonateOption ImpersonateOption) profiles.ClientProfile {
+	group := GetPostQuantumGroup(impersonateOption)
+	return wrapClientHelloSpec(clientProfile, func(spec *tls.ClientHelloSpec) error {
+		spec.Extensions = setPostQuantumGroup(spec.Extensions, group)
+		return nil
+	})
+}
+
+// Replaces the post-quantum group in supported_groups and key_share, drops it when the group is 0.
+// The group goes first after GREASE when the profile had none.
+func setPostQuantumGroup(extensions []tls.TLSExtension, group uint16) []tls.TLSExtension {
+	for _, extension := range extensions {
+		switch extension := extension.(type) {
+		case *tls.SupportedCurvesExtension:
+			extension.Curves = replacePostQuantumGroup(extension.Curves, func(curve tls.CurveID) uint16 {
+				return uint16(curve)
+			}, group, func(group uint16) tls.CurveID {
+				return tls.CurveID(group)
+			})
+		case *tls.KeyShareExtension:
+			extension.KeyShares = replacePostQuantumGroup(extension.KeyShares, func(keyShare tls.KeyShare) uint16 {
+				return uint16(keyShare.Group)
+			}, group, func(group uint16) tls.KeyShare {
+				return tls.KeyShare{Group: tls.CurveID(group)}
+			})
+		}
+	}
+	return extensions
+}
+
+// Same extensions as tls.ShuffleChromeTLSExtensions keeps in place
+func getTLSExtensionID(extension tls.TLSExtension) (uint16, bool) {
+	switch extension.(type) {
+	case *tls.UtlsGREASEExtension, *tls.UtlsPaddingExtension, tls.PreSharedKeyExtension:
+		return 0, false
+	case *tls.SNIExtension:
+		// server_name is empty until the handshake
+		return 0, true
+	}
+	raw := make([]byte, extension.Len())
+	if n, _ := extension.Read(raw); n < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(raw), true
+}
+
+// WithoutSessionResumption returns the profile without pre_shared_key, tls-client only keeps a session cache for profiles offering it.
+func WithoutSessionResumption(clientProfile profiles.ClientProfile) profiles.ClientProfile {
+	return wrapClientHelloSpec(clientProfile, func(spec *tls.ClientHelloSpec) error {
+		spec.Extensions = slices.DeleteFunc(spec.Extensions, func(extension tls.TLSExtension) bool {
+			_, isPSK := extension.(tls.PreSharedKeyExtension)
+			return isPSK
+		})
+		return nil
+	})
+}
+
+// wrapClientHelloSpec returns the profile with modify applied to the ClientHelloSpec of each connection.
+// Profiles without a SpecFactory are returned as is, utls builds their ClientHello.
+func wrapClientHelloSpec(clientProfile profiles.ClientProfile, modify func(spec *tls.ClientHelloSpec) error) profiles.ClientProfile {
+	clientHelloId := clientProfile.GetClientHelloId()
+	specFactory := clientHelloId.SpecFactory
+	if specFactory == nil {
+		return clientProfile
+	}
+	clientHelloId.SpecFactory = func() (tls.ClientHelloSpec, error) {
+		spec, err := specFactory()
+		if err != nil {
+			return spec, err
+		}
+		return spec, modify(&spec)
+	}
+	return rebuildClientProfile(clientProfile, clientHelloId, clientProfile.GetPriorities(), clientProfile.GetHeaderPriority())
+}
+
+// rebuildClientProfile returns the profile with another ClientHelloID, PRIORITY frames and HEADERS priority.
+func rebuildClientProfile(clientProfile profiles.ClientProfile, clientHelloId tls.ClientHelloID, priorities []http2.Priority, headerPriority *http2.PriorityParam) profiles.ClientProfile {
+	return profiles.NewClientProfile(
+		clientHelloId,
+		clientProfile.GetSettings(),
+		clientProfile.GetSettingsOrder(),
+		clientProfile.GetPseudoHeaderOrder(),
+		clientProfile.GetConnectionFlow(),
+		priorities,
+		headerPriority,
+	)
+}
+
 // Chrome-like pseudo header order
 var MASP_PseudoHeaderOrder = []string{
 	":method",
@@ -347,3 +516,33 @@ var Chrome142_IOS_26 = profiles.NewClientProfile(
 		Weight:    0,
 	},
 )
+
+// NSURLSession shares the ClientHello of Safari, but not its HTTP2 settings and pseudo header order
+var CFNetwork_IOS_26 = profiles.NewClientProfile(
+	Safari_IOS_26.GetClientHelloId(),
+	map[http2.SettingID]uint32{
+		http2.SettingEnablePush:           0,
+		http2.SettingInitialWindowSize:    2097152,
+		http2.SettingMaxConcurrentStreams: 100,
+		http2.SettingNoRFC7540Priorities:  1,
+	},
+	[]http2.SettingID{
+		http2.SettingEnablePush,
+		http2.SettingInitialWindowSize,
+		http2.SettingMaxConcurrentStreams,
+		http2.SettingNoRFC7540Priorities,
+	},
+	[]string{
+		":method",
+		":scheme",
+		":path",
+		":authority",
+	},
+	uint32(10485760),
+	[]http2.Priority{},
+	&http2.PriorityParam{
+		StreamDep: 0,
+		Exclusive: false,
+		Weight:    0,
+	},
+)
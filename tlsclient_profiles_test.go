@@ -0,0 +1,172 @@
+//go:build !no_tlsclient
+
+package browser_impersonate
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+)
+
+func TestGetGeckoClientProfile(t *testing.T) {
+	tests := []struct {
+		browser ImpersonateBrowser
+		want    profiles.ClientProfile
+	}{
+		{browser: ImpersonateBrowser{Type: BrowserFirefox}, want: FirefoxClientProfile},
+		{browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 115}, want: FirefoxESR115ClientProfile},
+		{browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 128}, want: FirefoxESR128ClientProfile},
+		{browser: ImpersonateBrowser{Type: BrowserFirefoxESR}, want: FirefoxESR140ClientProfile},
+		{browser: ImpersonateBrowser{Type: BrowserTorBrowser, Version: 13}, want: FirefoxESR115ClientProfile},
+		{browser: ImpersonateBrowser{Type: BrowserTorBrowser, Version: 14}, want: FirefoxESR128ClientProfile},
+	}
+	for _, test := range tests {
+		got := GetGeckoClientProfile(test.browser).GetClientHelloId()
+		if want := test.want.GetClientHelloId(); got.Str() != want.Str() {
+			t.Errorf("GetGeckoClientProfile(%s %d) = %s, want %s", test.browser.Type, test.browser.Version, got.Str(), want.Str())
+		}
+	}
+}
+
+func TestGetOkHttpClientProfile(t *testing.T) {
+	tests := []struct {
+		osVersion string
+		want      profiles.ClientProfile
+	}{
+		{osVersion: "7", want: profiles.Okhttp4Android7},
+		{osVersion: "10", want: profiles.Okhttp4Android10},
+		{osVersion: "12", want: profiles.Okhttp4Android12},
+		{osVersion: "14", want: profiles.Okhttp4Android13},
+		{osVersion: "", want: profiles.Okhttp4Android13},
+	}
+	for _, test := range tests {
+		option := ImpersonateOption{OS: Android, OSVersion: test.osVersion, Browser: ImpersonateBrowser{Type: BrowserOkHttp}}
+		got := GetOkHttpClientProfile(option).GetClientHelloId()
+		if want := test.want.GetClientHelloId(); got.Str() != want.Str() {
+			t.Errorf("GetOkHttpClientProfile(Android %q) = %s, want %s", test.osVersion, got.Str(), want.Str())
+		}
+	}
+}
+
+func TestWithoutSessionResumption(t *testing.T) {
+	tests := []struct {
+		clientProfile profiles.ClientProfile
+		offersPSK     bool
+	}{
+		{clientProfile: Chrome141_ClientProfile, offersPSK: true},
+		{clientProfile: FirefoxESR115ClientProfile},
+		{clientProfile: FirefoxESR140ClientProfile},
+	}
+	for _, test := range tests {
+		clientHelloId := test.clientProfile.GetClientHelloId()
+		extensions := getSpecExtensions(t, clientHelloId)
+		if offersPSK := countPreSharedKey(extensions) > 0; offersPSK != test.offersPSK {
+			t.Fatalf("%s offers pre_shared_key: %t, want %t", clientHelloId.Str(), offersPSK, test.offersPSK)
+		}
+		withoutPSK := getSpecExtensions(t, WithoutSessionResumption(test.clientProfile).GetClientHelloId())
+		if got := countPreSharedKey(withoutPSK); got != 0 {
+			t.Errorf("%s still offers pre_shared_key", clientHelloId.Str())
+		}
+		if len(withoutPSK) != len(extensions)-countPreSharedKey(extensions) {
+			t.Errorf("%s has %d extensions without pre_shared_key, want %d", clientHelloId.Str(), len(withoutPSK), len(extensions)-countPreSharedKey(extensions))
+		}
+	}
+}
+
+func TestWithHTTP2Priorities(t *testing.T) {
+	tests := []struct {
+		name           string
+		option         ImpersonateOption
+		priorities     []http2.Priority
+		headerPriority http2.PriorityParam
+	}{
+		{
+			name:           "chrome",
+			option:         ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}},
+			priorities:     []http2.Priority{},
+			headerPriority: http2.PriorityParam{Exclusive: true, Weight: 255},
+		},
+		{
+			name:   "firefox esr 115",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 115}},
+			priorities: []http2.Priority{
+				{StreamID: 3, PriorityParam: http2.PriorityParam{Weight: 200}},
+				{StreamID: 5, PriorityParam: http2.PriorityParam{Weight: 100}},
+				{StreamID: 7, PriorityParam: http2.PriorityParam{Weight: 0}},
+				{StreamID: 9, PriorityParam: http2.PriorityParam{StreamDep: 7, Weight: 0}},
+				{StreamID: 11, PriorityParam: http2.PriorityParam{StreamDep: 3, Weight: 0}},
+				{StreamID: 13, PriorityParam: http2.PriorityParam{Weight: 240}},
+			},
+			headerPriority: http2.PriorityParam{StreamDep: 13, Weight: 41},
+		},
+	}
+	for _, test := range tests {
+		clientProfile := WithHTTP2Priorities(Chrome141_ClientProfile, test.option)
+		if got := clientProfile.GetPriorities(); !reflect.DeepEqual(got, test.priorities) {
+			t.Errorf("%s: priorities = %+v, want %+v", test.name, got, test.priorities)
+		}
+		if got := clientProfile.GetHeaderPriority(); got == nil || *got != test.headerPriority {
+			t.Errorf("%s: header priority = %+v, want %+v", test.name, got, test.headerPriority)
+		}
+		got, want := clientProfile.GetClientHelloId(), Chrome141_ClientProfile.GetClientHelloId()
+		if got.Str() != want.Str() {
+			t.Errorf("%s: ClientHelloID = %s, want %s", test.name, got.Str(), want.Str())
+		}
+	}
+}
+
+func TestWithTLSExtensionSeed(t *testing.T) {
+	extensionOrder := func(clientProfile profiles.ClientProfile) []string {
+		order := []string{}
+		for _, extension := range getSpecExtensions(t, clientProfile.GetClientHelloId()) {
+			order = append(order, fmt.Sprintf("%T", extension))
+		}
+		return order
+	}
+	tests := []struct {
+		name      string
+		seeds     [2]int64
+		sameOrder bool
+	}{
+		{name: "same seed", seeds: [2]int64{1, 1}, sameOrder: true},
+		{name: "other seed", seeds: [2]int64{1, 2}, sameOrder: false},
+	}
+	for _, test := range tests {
+		first := WithTLSExtensionSeed(Chrome141_ClientProfile, test.seeds[0])
+		second := WithTLSExtensionSeed(Chrome141_ClientProfile, test.seeds[1])
+		if first.GetClientHelloId().RandomExtensionOrder {
+			t.Errorf("%s: the seeded profile still shuffles on every connection", test.name)
+		}
+		if sameOrder := slices.Equal(extensionOrder(first), extensionOrder(second)); sameOrder != test.sameOrder {
+			t.Errorf("%s: same extension order: %t, want %t", test.name, sameOrder, test.sameOrder)
+		}
+		// Every connection of a session sends the same order
+		if !slices.Equal(extensionOrder(first), extensionOrder(first)) {
+			t.Errorf("%s: the extension order changed between connections", test.name)
+		}
+	}
+}
+
+func getSpecExtensions(t *testing.T, clientHelloId tls.ClientHelloID) []tls.TLSExtension {
+	t.Helper()
+	spec, err := clientHelloId.SpecFactory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec.Extensions
+}
+
+func countPreSharedKey(extensions []tls.TLSExtension) int {
+	count := 0
+	for _, extension := range extensions {
+		if _, isPSK := extension.(tls.PreSharedKeyExtension); isPSK {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,104 @@
+//go:build !no_tlsclient
+
+package browser_impersonate
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	fhttp "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+)
+
+func TestNewImpersonateTLShttpClientUnsupportedOptions(t *testing.T) {
+	chrome := ImpersonateBrowser{Type: BrowserChrome}
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		err    error // Type of the expected error, nil when the client is built
+	}{
+		{name: "chrome", option: ImpersonateOption{OS: Windows, Browser: chrome}},
+		{name: "TLS session store", option: ImpersonateOption{OS: Windows, Browser: chrome, TLSSessionStore: NewTLSSessionStore()}, err: &UnsupportedCombinationError{}},
+		{name: "ECH resolver", option: ImpersonateOption{OS: Windows, Browser: chrome, ECHResolver: ECHConfigList{}}, err: &UnsupportedCombinationError{}},
+	}
+	for _, test := range tests {
+		_, err := NewImpersonateTLShttpClient(test.option, nil)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+			t.Errorf("%s: NewImpersonateTLShttpClient() = %v, want an error of type %T", test.name, err, test.err)
+		}
+	}
+}
+
+func newTLSClientTestClient(t *testing.T, impersonateOption ImpersonateOption) tls_client.HttpClient {
+	t.Helper()
+	client, err := NewImpersonateTLShttpClient(impersonateOption, tls_client.NewNoopLogger(), tls_client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestTLSClientKeyExchange(t *testing.T) {
+	for _, test := range keyExchangeTests {
+		t.Run(test.name, func(t *testing.T) {
+			server, states := newTLSStateServer(t, &tls.Config{MinVersion: tls.VersionTLS13, CurvePreferences: test.serverGroups})
+			client := newTLSClientTestClient(t, ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}})
+			request, err := fhttp.NewRequest(fhttp.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if state := states()[0]; state.CurveID != test.curveID {
+				t.Fatalf("got %v, want %v", state.CurveID, test.curveID)
+			}
+		})
+	}
+}
+
+func TestTLSClientProxyRotation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	refusing, tunneling := newTestProxy(t, http.StatusForbidden), newTestProxy(t, http.StatusOK)
+	pool := newTestProxyPool(t, []string{refusing.URL, tunneling.URL}, ProxyPoolOptions{})
+	client := newTLSClientTestClient(t, ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome}, ProxyPool: pool, ProxyKey: "persona"})
+	if proxyURL := client.GetProxy(); proxyURL != refusing.URL {
+		t.Fatalf("got %q, want %q", proxyURL, refusing.URL)
+	}
+	// Requests failing at once on the first proxy move the client once
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			request, err := fhttp.NewRequest(fhttp.MethodGet, server.URL, nil)
+			if err != nil {
+				return
+			}
+			if response, err := client.Do(request); err == nil {
+				response.Body.Close()
+			}
+		})
+	}
+	wg.Wait()
+	if proxyURL := client.GetProxy(); proxyURL != tunneling.URL {
+		t.Fatalf("got %q, want %q", proxyURL, tunneling.URL)
+	}
+	if stats := pool.Stats(); stats[0].Rotations != 1 || stats[1].Keys != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	request, err := fhttp.NewRequest(fhttp.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+}
@@ -0,0 +1,93 @@
+package browser_impersonate
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// GetTLSExtensionSeed returns the seed of the extension order for a new session.
+// Chrome shuffles its extensions once per launch, so every connection of a session shares the order.
+func GetTLSExtensionSeed(impersonateOption ImpersonateOption) int64 {
+	if impersonateOption.TLSExtensionSeed != 0 {
+		return impersonateOption.TLSExtensionSeed
+	}
+	return rand.Int63()
+}
+
+// GetTLSExtensionPermutation returns the order to send the shuffled extensions in, as indexes into extensionIDs.
+// extensionIDs are the ones Chrome shuffles, every extension but GREASE, padding and pre_shared_key.
+// The order only depends on the seed and the set of extensions, not on the order they are given in.
+func GetTLSExtensionPermutation(extensionIDs []uint16, seed int64) []int {
+	permutation := make([]int, len(extensionIDs))
+	for i := range permutation {
+		permutation[i] = i
+	}
+	slices.SortStableFunc(permutation, func(a int, b int) int {
+		return int(extensionIDs[a]) - int(extensionIDs[b])
+	})
+	rand.New(rand.NewSource(seed)).Shuffle(len(permutation), func(i int, j int) {
+		permutation[i], permutation[j] = permutation[j], permutation[i]
+	})
+	return permutation
+}
+
+// GREASE value the utls forks put in supported_groups and key_share, replaced by a random one in each ClientHello.
+const greasePlaceholder uint16 = 0x0a0a
+
+// Extension rewrites shared by the utls forks, which have distinct types for the same extensions.
+// Each fork adapts its extensions to their uint16 IDs, groups and codepoints.
+
+// Removes the post-quantum groups of a supported_groups or key_share list, then inserts group unless it is 0.
+// The group goes first after GREASE, where browsers put it.
+func replacePostQuantumGroup[T any](items []T, groupOf func(T) uint16, group uint16, newItem func(group uint16) T) []T {
+	replaced := []T{}
+	position := 0
+	for _, item := range items {
+		switch {
+		case IsPostQuantumGroup(groupOf(item)):
+			continue
+		case groupOf(item) == greasePlaceholder:
+			position = len(replaced) + 1
+		}
+		replaced = append(replaced, item)
+	}
+	if group != 0 {
+		replaced = slices.Insert(replaced, position, newItem(group))
+	}
+	return replaced
+}
+
+// Replaces the application_settings extension with the one of the codepoint, drops it when the codepoint is 0.
+// supportedProtocols reports the protocols of the ALPS extensions, newALPS builds the extension of a codepoint.
+func replaceALPSExtension[E any](extensions []E, codepoint uint16, supportedProtocols func(E) ([]string, bool), newALPS func(codepoint uint16, supportedProtocols []string) E) []E {
+	replaced := []E{}
+	for _, extension := range extensions {
+		protocols, isALPS := supportedProtocols(extension)
+		switch {
+		case !isALPS:
+			replaced = append(replaced, extension)
+		case codepoint != 0:
+			replaced = append(replaced, newALPS(codepoint, protocols))
+		}
+	}
+	return replaced
+}
+
+// Shuffles the extensions with GetTLSExtensionPermutation, extensionID reports false for the ones kept in place.
+func permuteExtensions[E any](extensions []E, seed int64, extensionID func(E) (uint16, bool)) []E {
+	positions := []int{}
+	extensionIDs := []uint16{}
+	for i, extension := range extensions {
+		id, shuffled := extensionID(extension)
+		if !shuffled {
+			continue
+		}
+		positions = append(positions, i)
+		extensionIDs = append(extensionIDs, id)
+	}
+	permuted := slices.Clone(extensions)
+	for i, j := range GetTLSExtensionPermutation(extensionIDs, seed) {
+		permuted[positions[i]] = extensions[positions[j]]
+	}
+	return permuted
+}
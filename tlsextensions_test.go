@@ -0,0 +1,136 @@
+package browser_impersonate
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestGetTLSExtensionSeed(t *testing.T) {
+	if got := GetTLSExtensionSeed(ImpersonateOption{TLSExtensionSeed: 42}); got != 42 {
+		t.Errorf("GetTLSExtensionSeed() = %d, want 42", got)
+	}
+	if GetTLSExtensionSeed(ImpersonateOption{}) == GetTLSExtensionSeed(ImpersonateOption{}) {
+		t.Errorf("GetTLSExtensionSeed() returned the same seed twice")
+	}
+}
+
+func TestGetTLSExtensionPermutation(t *testing.T) {
+	tests := []struct {
+		name         string
+		extensionIDs []uint16
+		seed         int64
+		want         []uint16 // Extension IDs in the permuted order
+	}{
+		{name: "seed 1", extensionIDs: []uint16{0, 23, 65281, 10, 11, 35, 16}, seed: 1, want: []uint16{0, 11, 65281, 10, 16, 35, 23}},
+		{name: "seed 1 in another order", extensionIDs: []uint16{65281, 0, 23, 10, 11, 35, 16}, seed: 1, want: []uint16{0, 11, 65281, 10, 16, 35, 23}},
+		{name: "seed 2", extensionIDs: []uint16{0, 23, 65281, 10, 11, 35, 16}, seed: 2, want: []uint16{16, 11, 35, 23, 0, 65281, 10}},
+		{name: "no extensions", extensionIDs: []uint16{}, seed: 1, want: []uint16{}},
+	}
+	for _, test := range tests {
+		got := []uint16{}
+		for _, i := range GetTLSExtensionPermutation(test.extensionIDs, test.seed) {
+			got = append(got, test.extensionIDs[i])
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: GetTLSExtensionPermutation() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Starts a TLS 1.3 server recording the connection state of the requests it gets.
+func newTLSStateServer(t *testing.T, config *tls.Config) (*httptest.Server, func() []tls.ConnectionState) {
+	t.Helper()
+	var mu sync.Mutex
+	states := []tls.ConnectionState{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, *r.TLS)
+	}))
+	server.TLS = config
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, func() []tls.ConnectionState {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(states)
+	}
+}
+
+// Key exchanges of Chrome, which sends post-quantum and X25519 shares.
+// A server only supporting P-256 gets no share for it and asks for one with a HelloRetryRequest.
+var keyExchangeTests = []struct {
+	name         string
+	serverGroups []tls.CurveID
+	curveID      tls.CurveID
+}{
+	{name: "post-quantum share", serverGroups: []tls.CurveID{tls.X25519MLKEM768}, curveID: tls.X25519MLKEM768},
+	{name: "X25519 share", serverGroups: []tls.CurveID{tls.X25519}, curveID: tls.X25519},
+	{name: "HelloRetryRequest", serverGroups: []tls.CurveID{tls.CurveP256}, curveID: tls.CurveP256},
+}
+
+func TestReplacePostQuantumGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []uint16
+		group  uint16
+		want   []uint16
+	}{
+		{name: "inserted after GREASE", groups: []uint16{greasePlaceholder, 29, 23}, group: CurveX25519MLKEM768, want: []uint16{greasePlaceholder, CurveX25519MLKEM768, 29, 23}},
+		{name: "inserted first without GREASE", groups: []uint16{29, 23}, group: CurveX25519MLKEM768, want: []uint16{CurveX25519MLKEM768, 29, 23}},
+		{name: "replaced", groups: []uint16{greasePlaceholder, CurveX25519Kyber768Draft00, 29}, group: CurveX25519MLKEM768, want: []uint16{greasePlaceholder, CurveX25519MLKEM768, 29}},
+		{name: "dropped", groups: []uint16{greasePlaceholder, CurveX25519MLKEM768, 29}, group: 0, want: []uint16{greasePlaceholder, 29}},
+	}
+	identity := func(group uint16) uint16 { return group }
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := replacePostQuantumGroup(test.groups, identity, test.group, identity); !slices.Equal(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplaceALPSExtension(t *testing.T) {
+	// Extensions are their codepoints, 0 stands for another extension
+	supportedProtocols := func(extension uint16) ([]string, bool) {
+		return []string{"h2"}, extension == ALPSCodepoint || extension == ALPSCodepointNew
+	}
+	newALPS := func(codepoint uint16, supportedProtocols []string) uint16 { return codepoint }
+	extensions := []uint16{0, ALPSCodepoint, 0}
+	if got := replaceALPSExtension(extensions, ALPSCodepointNew, supportedProtocols, newALPS); !slices.Equal(got, []uint16{0, ALPSCodepointNew, 0}) {
+		t.Fatalf("got %v with the new codepoint", got)
+	}
+	if got := replaceALPSExtension(extensions, 0, supportedProtocols, newALPS); !slices.Equal(got, []uint16{0, 0}) {
+		t.Fatalf("got %v without ALPS", got)
+	}
+}
+
+func TestPermuteExtensions(t *testing.T) {
+	// GREASE and padding stay in place
+	extensions := []uint16{greasePlaceholder, 0, 5, 10, 11, 13, 16, 23, 35, 43, 45, 51, 21}
+	extensionID := func(extension uint16) (uint16, bool) {
+		return extension, extension != greasePlaceholder && extension != 21
+	}
+	permuted := permuteExtensions(extensions, 42, extensionID)
+	if permuted[0] != greasePlaceholder || permuted[len(permuted)-1] != 21 {
+		t.Fatalf("fixed extensions moved: %v", permuted)
+	}
+	if slices.Equal(permuted, extensions) {
+		t.Fatalf("extensions were not shuffled")
+	}
+	if !slices.Equal(slices.Sorted(slices.Values(permuted)), slices.Sorted(slices.Values(extensions))) {
+		t.Fatalf("extensions were lost: %v", permuted)
+	}
+	// Same seed, same order, whatever the order of the profile
+	reversed := slices.Clone(extensions)
+	slices.Reverse(reversed[1 : len(reversed)-1])
+	if again := permuteExtensions(reversed, 42, extensionID); !slices.Equal(again, permuted) {
+		t.Fatalf("got %v from the reversed profile, want %v", again, permuted)
+	}
+}
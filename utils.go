@@ -1,11 +1,29 @@
 package browser_impersonate
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type AnyHttpHeader interface {
 	Set(key string, value string)
 }
 
+// Wraps a header so helpers setting several headers at once leave OverwriteHeaders untouched.
+type overwriteProtectedHeader struct {
+	headers          AnyHttpHeader
+	overwriteHeaders map[string]string
+}
+
+func (p overwriteProtectedHeader) Set(key string, value string) {
+	for k := range p.overwriteHeaders {
+		if strings.EqualFold(k, key) {
+			return
+		}
+	}
+	p.headers.Set(key, value)
+}
+
 // Only relevant to Chromium based browsers anyway.
 func BrowserTypeToSecChUaName(browserType BrowserType) string {
 	switch browserType {
@@ -15,6 +33,16 @@ func BrowserTypeToSecChUaName(browserType BrowserType) string {
 		return "Brave"
 	case BrowserEdge:
 		return "Microsoft Edge"
+	case BrowserSamsung:
+		return "Samsung Internet"
+	case BrowserYandex:
+		return "YaBrowser"
+	case BrowserDuckDuckGo:
+		// Built on the System WebView, which provides the brand
+		return "Android WebView"
+	case BrowserVivaldi:
+		// Vivaldi does not advertise a brand of its own
+		return ""
 	default:
 		return "Google Chrome"
 	}
@@ -25,25 +53,81 @@ func GetSecChUaHeader(browserInfo ImpersonateBrowser) string {
 		secChUa := `"Not;A=Brand";v="99", "Opera";v="123", "Chromium";v="139"`
 		return secChUa
 	default:
-		secChUa := fmt.Sprintf(`"Chromium";v="%d", "%s";v="%d", "Not_A Brand";v="99"`,
-			browserInfo.Version,
-			BrowserTypeToSecChUaName(browserInfo.Type),
-			browserInfo.Version,
-		)
-		return secChUa
+		return formatSecChUaBrands(browserInfo, false)
 	}
 }
 
+func GetSecChUaFullVersionList(browserInfo ImpersonateBrowser) string {
+	if browserInfo.Version == 0 {
+		browserInfo.Version = GetLatestVersion(browserInfo.Type)
+	}
+	return formatSecChUaBrands(browserInfo, true)
+}
+
+// Brand version as the vendor reports it, some do not follow the Chromium version.
+func getSecChUaBrandVersion(browserInfo ImpersonateBrowser, full bool) string {
+	switch browserInfo.Type {
+	case BrowserSamsung:
+		if full {
+			return GetSamsungInternetVersion(browserInfo.Version) + ".0.0"
+		}
+		return GetSamsungInternetVersion(browserInfo.Version)
+	case BrowserYandex:
+		if full {
+			return GetYandexVersion(browserInfo.Version) + ".0.0"
+		}
+		return GetYandexVersion(browserInfo.Version)
+	default:
+		if full {
+			return GetChromeFullVersion(browserInfo.Version)
+		}
+		return fmt.Sprint(browserInfo.Version)
+	}
+}
+
+func formatSecChUaBrands(browserInfo ImpersonateBrowser, full bool) string {
+	chromiumVersion, greaseVersion := fmt.Sprint(browserInfo.Version), "99"
+	if full {
+		chromiumVersion, greaseVersion = GetChromeFullVersion(browserInfo.Version), "99.0.0.0"
+	}
+	brands := []string{fmt.Sprintf(`"Chromium";v="%s"`, chromiumVersion)}
+	if brand := BrowserTypeToSecChUaName(browserInfo.Type); brand != "" {
+		brands = append(brands, fmt.Sprintf(`"%s";v="%s"`, brand, getSecChUaBrandVersion(browserInfo, full)))
+	}
+	brands = append(brands, fmt.Sprintf(`"Not_A Brand";v="%s"`, greaseVersion))
+	if browserInfo.Type == BrowserYandex {
+		yowserVersion := "2.5"
+		if full {
+			yowserVersion = "2.5.0.0"
+		}
+		brands = append(brands, fmt.Sprintf(`"Yowser";v="%s"`, yowserVersion))
+	}
+	return strings.Join(brands, ", ")
+}
+
 func HeaderChromeSecChUA(headers AnyHttpHeader, impersonateOption ImpersonateOption) {
 	mobile := "?0"
-	if impersonateOption.OS.IsMobile() {
+	if impersonateOption.IsMobile() {
 		mobile = "?1"
 	}
 
 	secChUa := GetSecChUaHeader(impersonateOption.Browser)
+	fullVersionList := GetSecChUaFullVersionList(impersonateOption.Browser)
+	if impersonateOption.WebView {
+		// Same brands as DuckDuckGo, which is a WebView as well.
+		webView := ImpersonateBrowser{Type: BrowserDuckDuckGo, Version: impersonateOption.Browser.Version}
+		secChUa = GetSecChUaHeader(webView)
+		fullVersionList = GetSecChUaFullVersionList(webView)
+	}
 	headers.Set("Sec-Ch-Ua", secChUa)
 	headers.Set("Sec-Ch-Ua-Mobile", mobile)
 	headers.Set("Sec-Ch-Ua-Platform", impersonateOption.OS.GetSecChPlatform())
+	if impersonateOption.HighEntropyHints {
+		headers.Set("Sec-Ch-Ua-Platform-Version", GetSecChPlatformVersion(impersonateOption))
+		headers.Set("Sec-Ch-Ua-Full-Version-List", fullVersionList)
+		headers.Set("Sec-Ch-Ua-Model", GetSecChUaModel(impersonateOption))
+		headerScreenHints(headers, impersonateOption.Device.Screen)
+	}
 }
 
 func HeaderSecFetch(headers AnyHttpHeader, includeSecFetchUser bool) {
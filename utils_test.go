@@ -0,0 +1,50 @@
+package browser_impersonate
+
+import "testing"
+
+func TestGetSecChUaHeader(t *testing.T) {
+	tests := []struct {
+		browser  ImpersonateBrowser
+		want     string
+		wantFull string
+	}{
+		{
+			browser:  ImpersonateBrowser{Type: BrowserChrome, Version: 142},
+			want:     `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`,
+			wantFull: `"Chromium";v="142.0.7444.46", "Google Chrome";v="142.0.7444.46", "Not_A Brand";v="99.0.0.0"`,
+		},
+		{
+			browser:  ImpersonateBrowser{Type: BrowserEdge, Version: 141},
+			want:     `"Chromium";v="141", "Microsoft Edge";v="141", "Not_A Brand";v="99"`,
+			wantFull: `"Chromium";v="141.0.7390.54", "Microsoft Edge";v="141.0.7390.54", "Not_A Brand";v="99.0.0.0"`,
+		},
+		{
+			browser:  ImpersonateBrowser{Type: BrowserSamsung, Version: 136},
+			want:     `"Chromium";v="136", "Samsung Internet";v="29.0", "Not_A Brand";v="99"`,
+			wantFull: `"Chromium";v="136.0.7103.48", "Samsung Internet";v="29.0.0.0", "Not_A Brand";v="99.0.0.0"`,
+		},
+		{
+			browser:  ImpersonateBrowser{Type: BrowserYandex, Version: 140},
+			want:     `"Chromium";v="140", "YaBrowser";v="25.10", "Not_A Brand";v="99", "Yowser";v="2.5"`,
+			wantFull: `"Chromium";v="140.0.7339.80", "YaBrowser";v="25.10.0.0", "Not_A Brand";v="99.0.0.0", "Yowser";v="2.5.0.0"`,
+		},
+		{
+			browser:  ImpersonateBrowser{Type: BrowserVivaldi, Version: 142},
+			want:     `"Chromium";v="142", "Not_A Brand";v="99"`,
+			wantFull: `"Chromium";v="142.0.7444.46", "Not_A Brand";v="99.0.0.0"`,
+		},
+		{
+			browser:  ImpersonateBrowser{Type: BrowserDuckDuckGo, Version: 142},
+			want:     `"Chromium";v="142", "Android WebView";v="142", "Not_A Brand";v="99"`,
+			wantFull: `"Chromium";v="142.0.7444.46", "Android WebView";v="142.0.7444.46", "Not_A Brand";v="99.0.0.0"`,
+		},
+	}
+	for _, test := range tests {
+		if got := GetSecChUaHeader(test.browser); got != test.want {
+			t.Errorf("GetSecChUaHeader(%s %d) = %s, want %s", test.browser.Type, test.browser.Version, got, test.want)
+		}
+		if got := GetSecChUaFullVersionList(test.browser); got != test.wantFull {
+			t.Errorf("GetSecChUaFullVersionList(%s %d) = %s, want %s", test.browser.Type, test.browser.Version, got, test.wantFull)
+		}
+	}
+}
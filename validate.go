@@ -0,0 +1,268 @@
+package browser_impersonate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	LatestChromeVersion  = 142
+	LatestFirefoxVersion = 145
+	LatestSafariVersion  = 26
+
+	LatestFirefoxESRVersion = 140
+	LatestTorBrowserVersion = 15
+
+	LatestOkHttpVersion = 5
+
+	// Samsung Internet lags behind Chrome
+	LatestSamsungChromiumVersion = 136
+)
+
+// SafariVersions are the Safari releases, ImpersonateBrowser.Version of BrowserSafari must be one of them.
+// Apple went from 18 to 26 to follow the year of its OS releases, iOS included.
+var SafariVersions = []int{15, 16, 17, 18, 26}
+
+// UnsupportedCombinationError is returned when the OS and browser pair does not exist in the wild,
+// or is not something this package is able to impersonate.
+type UnsupportedCombinationError struct {
+	OS      ImpersonateOS
+	Browser BrowserType
+	Reason  string
+}
+
+func (e *UnsupportedCombinationError) Error() string {
+	return fmt.Sprintf("browser_impersonate: unsupported combination %s on %s: %s", e.Browser, e.OS, e.Reason)
+}
+
+// UnknownVersionError is returned when the requested browser version is outside the range we know how to impersonate.
+type UnknownVersionError struct {
+	Browser BrowserType
+	Version int
+	Min     int
+	Max     int
+}
+
+func (e *UnknownVersionError) Error() string {
+	return fmt.Sprintf("browser_impersonate: unknown %s version %d (supported: %d-%d)", e.Browser, e.Version, e.Min, e.Max)
+}
+
+// ConflictingOverrideError is returned when OverwriteHeaders contradicts the rest of the persona.
+type ConflictingOverrideError struct {
+	Header string
+	Reason string
+}
+
+func (e *ConflictingOverrideError) Error() string {
+	return fmt.Sprintf("browser_impersonate: conflicting override for %q: %s", e.Header, e.Reason)
+}
+
+// Oldest version per browser that the generated headers and TLS profiles still resemble.
+var minBrowserVersion = map[BrowserType]int{
+	BrowserChrome:  100,
+	BrowserEdge:    100,
+	BrowserBrave:   100,
+	BrowserFirefox: 102,
+	BrowserSafari:  15,
+
+	BrowserVivaldi:    120,
+	BrowserSamsung:    122,
+	BrowserYandex:     120,
+	BrowserDuckDuckGo: 120,
+
+	BrowserFirefoxESR: 115,
+	BrowserTorBrowser: 13,
+
+	BrowserOkHttp: 3,
+}
+
+var latestBrowserVersion = map[BrowserType]int{
+	BrowserChrome:  LatestChromeVersion,
+	BrowserEdge:    LatestChromeVersion,
+	BrowserBrave:   LatestChromeVersion,
+	BrowserFirefox: LatestFirefoxVersion,
+	BrowserSafari:  LatestSafariVersion,
+
+	BrowserVivaldi:    LatestChromeVersion,
+	BrowserSamsung:    LatestSamsungChromiumVersion,
+	BrowserYandex:     LatestChromeVersion,
+	BrowserDuckDuckGo: LatestChromeVersion,
+
+	BrowserFirefoxESR: LatestFirefoxESRVersion,
+	BrowserTorBrowser: LatestTorBrowserVersion,
+
+	BrowserOkHttp: LatestOkHttpVersion,
+}
+
+// GetLatestVersion returns the version used when ImpersonateBrowser.Version is not set.
+// Chromium based browsers are versioned by their Chromium major version.
+func GetLatestVersion(browserType BrowserType) int {
+	if version, ok := latestBrowserVersion[browserType]; ok {
+		return version
+	}
+	return LatestChromeVersion
+}
+
+// Validate checks that the OS, browser, version and header overrides describe a realistic persona.
+// It returns an *UnsupportedCombinationError, *UnknownVersionError or *ConflictingOverrideError.
+func (o ImpersonateOption) Validate() error {
+	if o.OS < Windows || o.OS > IOS {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "unknown OS"}
+	}
+	if !validateOSVersion(o) {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: fmt.Sprintf("unknown OS version %q", o.OSVersion)}
+	}
+	for _, locale := range o.Locales {
+		if NormalizeLanguageTag(locale) == "" {
+			return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "empty language tag in Locales"}
+		}
+	}
+	if o.Device.Model != "" && o.OS != Android {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "device models are only supported on Android"}
+	}
+	if o.Device.Class == DeviceTablet && !o.OS.IsMobile() {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "tablets are either iPads or Android tablets"}
+	}
+	if o.WebView && (o.OS != Android || o.Browser.Type != BrowserChrome) {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "WebView is only Chrome on Android"}
+	}
+	if o.WebView && o.WebViewPackage == "" {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "WebView needs the WebViewPackage of the embedding app"}
+	}
+	if o.ProxyPool != nil && o.ProxyKey == "" {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: "ProxyPool needs the ProxyKey of the persona"}
+	}
+	if err := o.validateCombination(); err != nil {
+		return err
+	}
+	if err := o.validateVersion(); err != nil {
+		return err
+	}
+	return o.validateOverrides()
+}
+
+func (o ImpersonateOption) validateCombination() error {
+	unsupported := func(reason string) error {
+		return &UnsupportedCombinationError{OS: o.OS, Browser: o.Browser.Type, Reason: reason}
+	}
+	switch o.Browser.Type {
+	case BrowserSafari:
+		if o.OS != MacOS && o.OS != IOS {
+			return unsupported("Safari only ships on macOS and iOS")
+		}
+		if o.OS == IOS && o.Browser.Version != 0 && o.OSVersion != "" {
+			if numbers := parseOSVersion(o.OSVersion); numbers[0] != o.Browser.Version {
+				return unsupported("Safari on iOS ships with the OS, its version must match the iOS version")
+			}
+		}
+	case BrowserChrome, BrowserFirefox, BrowserEdge, BrowserBrave:
+	case BrowserVivaldi, BrowserYandex:
+		if o.OS.IsMobile() {
+			return unsupported("only the desktop browser is implemented")
+		}
+	case BrowserSamsung:
+		if o.OS != Android {
+			return unsupported("Samsung Internet only ships on Android")
+		}
+	case BrowserDuckDuckGo:
+		if !o.OS.IsMobile() {
+			return unsupported("only the mobile browser is implemented")
+		}
+	case BrowserFirefoxESR:
+		if o.OS.IsMobile() {
+			return unsupported("Firefox ESR is only released for desktop")
+		}
+	case BrowserTorBrowser:
+		if o.OS.IsMobile() {
+			return unsupported("only the desktop Tor Browser is implemented")
+		}
+		if len(o.Locales) > 0 || o.Country != "" {
+			return unsupported("Tor Browser always reports en-US")
+		}
+	case BrowserOkHttp:
+		if o.OS != Android {
+			return unsupported("OkHttp personas are Android apps")
+		}
+	case BrowserCFNetwork:
+		if o.OS != IOS {
+			return unsupported("CFNetwork personas are iOS apps")
+		}
+		if o.App.Name == "" {
+			return unsupported("CFNetwork needs the App name for its User-Agent")
+		}
+		if _, ok := cfNetworkVersions[parseOSVersion(o.GetOSVersion())[0]]; !ok {
+			return unsupported("no CFNetwork version known for this iOS version")
+		}
+	case BrowserOpera:
+		return unsupported("no header generation for Opera")
+	default:
+		return unsupported("unknown browser")
+	}
+	return nil
+}
+
+func (o ImpersonateOption) validateVersion() error {
+	version := o.Browser.Version
+	if version == 0 || o.Browser.Type == BrowserCFNetwork {
+		// CFNetwork ships with iOS, OSVersion picks its version
+		return nil
+	}
+	minVersion, maxVersion := minBrowserVersion[o.Browser.Type], latestBrowserVersion[o.Browser.Type]
+	if version < minVersion || version > maxVersion {
+		return &UnknownVersionError{Browser: o.Browser.Type, Version: version, Min: minVersion, Max: maxVersion}
+	}
+	if o.Browser.Type == BrowserFirefoxESR && !slices.Contains(FirefoxESRVersions, version) {
+		return &UnknownVersionError{Browser: o.Browser.Type, Version: version, Min: minVersion, Max: maxVersion}
+	}
+	if o.Browser.Type == BrowserSafari && !slices.Contains(SafariVersions, version) {
+		return &UnknownVersionError{Browser: o.Browser.Type, Version: version, Min: minVersion, Max: maxVersion}
+	}
+	return nil
+}
+
+func (o ImpersonateOption) validateOverrides() error {
+	if len(o.OverwriteHeaders) == 0 {
+		return nil
+	}
+	if o.SkipHeaders {
+		return &ConflictingOverrideError{Header: "*", Reason: "SkipHeaders is set, overrides would be ignored"}
+	}
+	seen := map[string]string{}
+	for k, v := range o.OverwriteHeaders {
+		lower := strings.ToLower(k)
+		if previous, ok := seen[lower]; ok && previous != v {
+			return &ConflictingOverrideError{Header: k, Reason: "set twice with different casing and values"}
+		}
+		seen[lower] = v
+	}
+	if _, ok := seen["accept-language"]; ok && (len(o.Locales) > 0 || o.Country != "") {
+		return &ConflictingOverrideError{Header: "accept-language", Reason: "Locales or Country is set as well"}
+	}
+
+	// Only Chromium on a non WebKit platform sends client hints.
+	sendsClientHints := !o.UsesWebKit() && o.Browser.Type.IsChromium()
+	for lower, v := range seen {
+		if !strings.HasPrefix(lower, "sec-ch-ua") {
+			continue
+		}
+		if !sendsClientHints {
+			return &ConflictingOverrideError{Header: lower, Reason: fmt.Sprintf("%s on %s does not send client hints", o.Browser.Type, o.OS)}
+		}
+		switch lower {
+		case "sec-ch-ua-mobile":
+			expected := "?0"
+			if o.IsMobile() {
+				expected = "?1"
+			}
+			if v != expected {
+				return &ConflictingOverrideError{Header: lower, Reason: fmt.Sprintf("expected %s for %s", expected, o.OS)}
+			}
+		case "sec-ch-ua-platform":
+			if v != o.OS.GetSecChPlatform() {
+				return &ConflictingOverrideError{Header: lower, Reason: fmt.Sprintf("expected %s for %s", o.OS.GetSecChPlatform(), o.OS)}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package browser_impersonate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	chrome := ImpersonateBrowser{Type: BrowserChrome}
+	tests := []struct {
+		name   string
+		option ImpersonateOption
+		err    error // Type of the expected error, nil for a valid persona
+	}{
+		{name: "chrome on windows", option: ImpersonateOption{OS: Windows, Browser: chrome}},
+		{name: "latest chrome", option: ImpersonateOption{OS: Linux, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: LatestChromeVersion}}},
+		{name: "safari on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 26}}},
+		{name: "unknown OS", option: ImpersonateOption{OS: IOS + 1, Browser: chrome}, err: &UnsupportedCombinationError{}},
+		{name: "safari on windows", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserSafari}}, err: &UnsupportedCombinationError{}},
+		{name: "edge on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserEdge}}},
+		{name: "opera", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserOpera}}, err: &UnsupportedCombinationError{}},
+		{name: "unknown browser", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: "lynx"}}, err: &UnsupportedCombinationError{}},
+		{name: "samsung internet on android", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserSamsung}}},
+		{name: "samsung internet on windows", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserSamsung}}, err: &UnsupportedCombinationError{}},
+		{name: "vivaldi on android", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserVivaldi}}, err: &UnsupportedCombinationError{}},
+		{name: "yandex on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserYandex}}, err: &UnsupportedCombinationError{}},
+		{name: "duckduckgo on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserDuckDuckGo}}},
+		{name: "duckduckgo on windows", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserDuckDuckGo}}, err: &UnsupportedCombinationError{}},
+		{name: "samsung internet ahead of its chromium", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserSamsung, Version: LatestSamsungChromiumVersion + 1}}, err: &UnknownVersionError{}},
+		{name: "firefox esr on linux", option: ImpersonateOption{OS: Linux, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 128}}},
+		{name: "firefox esr on android", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR}}, err: &UnsupportedCombinationError{}},
+		{name: "tor browser", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserTorBrowser}}},
+		{name: "tor browser with a country", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserTorBrowser}, Country: "DE"}, err: &UnsupportedCombinationError{}},
+		{name: "firefox esr 120", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefoxESR, Version: 120}}, err: &UnknownVersionError{}},
+		{name: "tor browser 16", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserTorBrowser, Version: 16}}, err: &UnknownVersionError{}},
+		{name: "okhttp on android", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp, Version: 4}}},
+		{name: "okhttp on ios", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserOkHttp}}, err: &UnsupportedCombinationError{}},
+		{name: "cfnetwork", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserCFNetwork}, App: ImpersonateApp{Name: "Weather"}}},
+		{name: "cfnetwork without app", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserCFNetwork}}, err: &UnsupportedCombinationError{}},
+		{name: "cfnetwork on macos", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserCFNetwork}, App: ImpersonateApp{Name: "Weather"}}, err: &UnsupportedCombinationError{}},
+		{name: "cfnetwork with a version", option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserCFNetwork, Version: 1498}, App: ImpersonateApp{Name: "Weather"}}},
+		{name: "okhttp 6", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserOkHttp, Version: 6}}, err: &UnknownVersionError{}},
+		{name: "chrome too old", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: 99}}, err: &UnknownVersionError{}},
+		{name: "chrome not released", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserChrome, Version: LatestChromeVersion + 1}}, err: &UnknownVersionError{}},
+		{name: "firefox not released", option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox, Version: LatestFirefoxVersion + 1}}, err: &UnknownVersionError{}},
+		{name: "safari 19", option: ImpersonateOption{OS: MacOS, Browser: ImpersonateBrowser{Type: BrowserSafari, Version: 19}}, err: &UnknownVersionError{}},
+		{name: "unknown iOS version", option: ImpersonateOption{OS: IOS, OSVersion: "19.0", Browser: chrome}, err: &UnsupportedCombinationError{}},
+		{name: "empty locale", option: ImpersonateOption{OS: Windows, Browser: chrome, Locales: []string{"en-US", " "}}, err: &UnsupportedCombinationError{}},
+		{name: "device model on ios", option: ImpersonateOption{OS: IOS, Browser: chrome, Device: ImpersonateDevice{Model: "iPhone"}}, err: &UnsupportedCombinationError{}},
+		{name: "tablet on windows", option: ImpersonateOption{OS: Windows, Browser: chrome, Device: ImpersonateDevice{Class: DeviceTablet}}, err: &UnsupportedCombinationError{}},
+		{name: "webview", option: ImpersonateOption{OS: Android, Browser: chrome, WebView: true, WebViewPackage: "com.example.app"}},
+		{name: "webview of firefox", option: ImpersonateOption{OS: Android, Browser: ImpersonateBrowser{Type: BrowserFirefox}, WebView: true, WebViewPackage: "com.example.app"}, err: &UnsupportedCombinationError{}},
+		{name: "webview without package", option: ImpersonateOption{OS: Android, Browser: chrome, WebView: true}, err: &UnsupportedCombinationError{}},
+		{
+			name:   "overrides with SkipHeaders",
+			option: ImpersonateOption{OS: Windows, Browser: chrome, SkipHeaders: true, OverwriteHeaders: map[string]string{"Accept": "*/*"}},
+			err:    &ConflictingOverrideError{},
+		},
+		{
+			name:   "same header twice",
+			option: ImpersonateOption{OS: Windows, Browser: chrome, OverwriteHeaders: map[string]string{"Accept": "*/*", "accept": "text/html"}},
+			err:    &ConflictingOverrideError{},
+		},
+		{
+			name:   "same header twice with the same value",
+			option: ImpersonateOption{OS: Windows, Browser: chrome, OverwriteHeaders: map[string]string{"Accept": "*/*", "accept": "*/*"}},
+		},
+		{
+			name:   "mobile client hint on windows",
+			option: ImpersonateOption{OS: Windows, Browser: chrome, OverwriteHeaders: map[string]string{"Sec-Ch-Ua-Mobile": "?1"}},
+			err:    &ConflictingOverrideError{},
+		},
+		{
+			name:   "mobile client hint on android",
+			option: ImpersonateOption{OS: Android, Browser: chrome, OverwriteHeaders: map[string]string{"Sec-Ch-Ua-Mobile": "?1"}},
+		},
+		{
+			name:   "mobile client hint on android tablet",
+			option: ImpersonateOption{OS: Android, Browser: chrome, Device: AndroidTablets[0], OverwriteHeaders: map[string]string{"Sec-Ch-Ua-Mobile": "?1"}},
+			err:    &ConflictingOverrideError{},
+		},
+		{
+			name:   "platform client hint of another OS",
+			option: ImpersonateOption{OS: MacOS, Browser: chrome, OverwriteHeaders: map[string]string{"Sec-Ch-Ua-Platform": `"Windows"`}},
+			err:    &ConflictingOverrideError{},
+		},
+		{
+			name:   "client hints on duckduckgo for ios",
+			option: ImpersonateOption{OS: IOS, Browser: ImpersonateBrowser{Type: BrowserDuckDuckGo}, OverwriteHeaders: map[string]string{"Sec-Ch-Ua-Mobile": "?1"}},
+			err:    &ConflictingOverrideError{},
+		},
+		{
+			name:   "client hints on firefox",
+			option: ImpersonateOption{OS: Windows, Browser: ImpersonateBrowser{Type: BrowserFirefox}, OverwriteHeaders: map[string]string{"Sec-Ch-Ua": `"Firefox";v="145"`}},
+			err:    &ConflictingOverrideError{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.option.Validate()
+			if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+				t.Fatalf("Validate() = %v, want an error of type %T", err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidateErrorMessages(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{
+			err:  &UnsupportedCombinationError{OS: Windows, Browser: BrowserSafari, Reason: "Safari only ships on macOS and iOS"},
+			want: "browser_impersonate: unsupported combination safari on Windows: Safari only ships on macOS and iOS",
+		},
+		{
+			err:  &UnknownVersionError{Browser: BrowserChrome, Version: 99, Min: 100, Max: LatestChromeVersion},
+			want: "browser_impersonate: unknown chrome version 99 (supported: 100-142)",
+		},
+		{
+			err:  &ConflictingOverrideError{Header: "sec-ch-ua-mobile", Reason: "expected ?0 for Windows"},
+			want: `browser_impersonate: conflicting override for "sec-ch-ua-mobile": expected ?0 for Windows`,
+		},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestGetLatestVersion(t *testing.T) {
+	tests := []struct {
+		browser BrowserType
+		want    int
+	}{
+		{browser: BrowserChrome, want: LatestChromeVersion},
+		{browser: BrowserFirefox, want: LatestFirefoxVersion},
+		{browser: BrowserSafari, want: LatestSafariVersion},
+		{browser: BrowserSamsung, want: LatestSamsungChromiumVersion},
+		{browser: BrowserVivaldi, want: LatestChromeVersion},
+		{browser: BrowserOpera, want: LatestChromeVersion},
+	}
+	for _, test := range tests {
+		if got := GetLatestVersion(test.browser); got != test.want {
+			t.Errorf("GetLatestVersion(%s) = %d, want %d", test.browser, got, test.want)
+		}
+	}
+}